@@ -0,0 +1,108 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HostsReport lists the remote hosts seen so far and the currently connected
+// clients, sorted and filtered as requested.
+type HostsReport struct {
+	Hosts   []HostEntry  `json:"hosts"`
+	Clients []ClientInfo `json:"clients"`
+	Sort    string       `json:"-"`
+	Filter  string       `json:"-"`
+	Token   string       `json:"-"` // The 'token' parameter, kept in the page's links and form.
+}
+
+// Orderings of the hosts, by the 'sort' parameter. The counts and times are
+// sorted in decreasing order, the rest alphabetically.
+var hostOrders = map[string]func(a, b HostEntry) int{
+	"count": func(a, b HostEntry) int { return cmp.Compare(b.Count, a.Count) },
+	"first": func(a, b HostEntry) int { return b.FirstSeen.Compare(a.FirstSeen) },
+	"last":  func(a, b HostEntry) int { return b.LastSeen.Compare(a.LastSeen) },
+	"ip":    func(a, b HostEntry) int { return strings.Compare(a.IP, b.IP) },
+	"agent": func(a, b HostEntry) int { return strings.Compare(a.UserAgent, b.UserAgent) },
+}
+
+// Columns of the hosts table, each can be sorted by.
+var hostColumns = []string{"ip", "agent", "count", "first", "last"}
+
+// Returns 'true' if any of the values contains the filter, ignoring case.
+func matches(filter string, values ...string) bool {
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), strings.ToLower(filter)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the report for the request parameters:
+//   - 'sort', one of "count" (the default), "first", "last", "ip" or "agent"
+//   - 'q', optional filter for the IP addresses and user agents
+func hostsReport(r *http.Request) (*HostsReport, error) {
+	params := r.URL.Query()
+	report := HostsReport{Sort: cmp.Or(params.Get("sort"), "count"), Filter: params.Get("q"),
+		Token: params.Get("token")}
+	order, ok := hostOrders[report.Sort]
+	if !ok {
+		return nil, fmt.Errorf("Invalid sort: '%s'.", report.Sort)
+	}
+
+	report.Hosts = slices.DeleteFunc(remoteHosts.entries(), func(h HostEntry) bool {
+		return !matches(report.Filter, h.IP, h.UserAgent)
+	})
+	slices.SortStableFunc(report.Hosts, func(a, b HostEntry) int {
+		// Ties are broken by the IP address and the user agent, for a stable order.
+		return cmp.Or(order(a, b), strings.Compare(a.IP, b.IP), strings.Compare(a.UserAgent, b.UserAgent))
+	})
+
+	// The most recently connected clients first.
+	report.Clients = slices.DeleteFunc(clients.list(), func(c ClientInfo) bool {
+		return !matches(report.Filter, c.RemoteAddr, c.UserAgent)
+	})
+	slices.SortFunc(report.Clients, func(a, b ClientInfo) int {
+		return cmp.Or(b.ConnectedAt.Compare(a.ConnectedAt), cmp.Compare(a.Id, b.Id))
+	})
+	return &report, nil
+}
+
+// Responds with JSON lists of the remote hosts and the connected clients, see hostsReport().
+func hostsHandler(w http.ResponseWriter, r *http.Request) {
+	logNewPeer(r)
+
+	report, err := hostsReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, report)
+}
+
+// Responds with an HTML page listing the remote hosts and the connected clients, see hostsReport().
+func hostsPageHandler(w http.ResponseWriter, r *http.Request) {
+	logNewPeer(r)
+
+	report, err := hostsReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmpl, err := template.New("admin_hosts.html").Funcs(template.FuncMap{
+		"ago":     func(t time.Time) string { return clock.Now().Sub(t).Round(time.Second).String() },
+		"columns": func() []string { return hostColumns },
+	}).ParseFS(f, "admin_hosts.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Replaces the global remote hosts and clients for the duration of the test.
+func setupHosts(t *testing.T) {
+	savedHosts, savedSeen := remoteHosts.set, remoteHosts.seen
+	remoteHosts.set, remoteHosts.seen = nil, nil
+	savedNow := mockClock.now
+	t.Cleanup(func() {
+		remoteHosts.set, remoteHosts.seen = savedHosts, savedSeen
+		mockClock.now = savedNow
+	})
+
+	for _, h := range []HostInfo{{ip: "10.0.0.2", userAgent: "curl"}, {ip: "10.0.0.1", userAgent: "firefox"}, {ip: "10.0.0.2", userAgent: "curl"}} {
+		remoteHosts.add(h)
+		mockClock.now = mockClock.now.Add(time.Minute)
+	}
+
+	client := &WsClient{connectedAt: clock.Now(), remoteAddr: "10.0.0.1:1234", userAgent: "firefox"}
+	clients.add(client)
+	t.Cleanup(func() { clients.remove(client) })
+}
+
+func getHosts(t *testing.T, query string) *HostsReport {
+	w := httptest.NewRecorder()
+	hostsHandler(w, httptest.NewRequest("GET", "/api/hosts"+query, nil))
+	var report HostsReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("hostsHandler(%s), unexpected error: %v, %s", query, err, w.Body.String())
+	}
+	return &report
+}
+
+func Test_hostsHandler(t *testing.T) {
+	setupHosts(t)
+
+	// The requests themselves come from 192.0.2.1, see httptest.NewRequest().
+	report := getHosts(t, "?q=10.0.0.")
+	if len(report.Hosts) != 2 || report.Hosts[0].IP != "10.0.0.2" || report.Hosts[0].Count != 2 {
+		t.Errorf("hostsHandler(), want: 10.0.0.2 first with 2 connections, got: %v", report.Hosts)
+	}
+	if len(report.Clients) != 1 || report.Clients[0].Kind != "websocket" || report.Clients[0].RemoteAddr != "10.0.0.1:1234" {
+		t.Errorf("hostsHandler(), want: 1 websocket client, got: %v", report.Clients)
+	}
+
+	// The most recently seen host first.
+	if report = getHosts(t, "?sort=last&q=10.0.0."); report.Hosts[0].UserAgent != "curl" ||
+		!report.Hosts[0].LastSeen.After(report.Hosts[0].FirstSeen) {
+		t.Errorf("hostsHandler(), want: curl first, got: %v", report.Hosts)
+	}
+	if report = getHosts(t, "?sort=ip"); report.Hosts[0].IP != "10.0.0.1" {
+		t.Errorf("hostsHandler(), want: 10.0.0.1 first, got: %v", report.Hosts)
+	}
+	if report = getHosts(t, "?q=FIREFOX"); len(report.Hosts) != 1 || len(report.Clients) != 1 {
+		t.Errorf("hostsHandler(), want: only firefox, got: %v", report)
+	}
+	if report = getHosts(t, "?q=curl"); len(report.Hosts) != 1 || len(report.Clients) != 0 {
+		t.Errorf("hostsHandler(), want: only curl, got: %v", report)
+	}
+
+	w := httptest.NewRecorder()
+	hostsHandler(w, httptest.NewRequest("GET", "/api/hosts?sort=argh", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("hostsHandler(), want: 400, got: %d", w.Code)
+	}
+}
+
+func Test_hostsPageHandler(t *testing.T) {
+	setupHosts(t)
+
+	w := httptest.NewRecorder()
+	hostsPageHandler(w, httptest.NewRequest("GET", "/admin/hosts?sort=ip&q=%3Cb%3E", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("hostsPageHandler(), want: 200, got: %d %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Remote hosts (0)", `class="sorted"><a href="?sort=ip`, "&lt;b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("hostsPageHandler(), want: %q in the page, got:\n%s", want, body)
+		}
+	}
+
+	// With '-auth', the token is kept in the links and the form.
+	w = httptest.NewRecorder()
+	hostsPageHandler(w, httptest.NewRequest("GET", "/admin/hosts?token=s3cr3t%2B", nil))
+	for _, want := range []string{`&token=s3cr3t%2b">ip</a>`, `name="token" value="s3cr3t&#43;"`} {
+		if body := w.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("hostsPageHandler(), want: %q in the page, got:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	hostsPageHandler(w, httptest.NewRequest("GET", "/admin/hosts?q=10.0.0.", nil))
+	if body := w.Body.String(); !strings.Contains(body, "Remote hosts (2)") || !strings.Contains(body, "10.0.0.1:1234") {
+		t.Errorf("hostsPageHandler(), want: 2 hosts and 1 client, got:\n%s", body)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Writes the value to the response as JSON.
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Returns the 'from' and 'to' date parameters of the request. The 'from' date
+// is required, the 'to' date defaults to today.
+func dateRangeParams(r *http.Request) (from, to string, err error) {
+	params := r.URL.Query()
+	from, to = params.Get("from"), params.Get("to")
+	if to == "" {
+		to = formatDate(clock.Now())
+	}
+	if !datePattern2.MatchString(from) {
+		return "", "", fmt.Errorf("Invalid date: '%s'.", from)
+	}
+	if !datePattern2.MatchString(to) {
+		return "", "", fmt.Errorf("Invalid date: '%s'.", to)
+	}
+	return
+}
+
+// Responds with JSON list of daily totals. The request has to specify:
+//   - 'from', the first date to return
+//   - 'to', optional last date to return, defaults to today
+func daysHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+
+		from, to, err := dateRangeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		days, err := db.ReadDays(from, to)
+		if err != nil {
+			slog.Error("failed to read days.", "err", err)
+			metrics.dbError("read_days")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, days)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_daysHandler(t *testing.T) {
+	db := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	db.StoreValue(now, 90*time.Minute, 30*time.Minute)
+
+	w := httptest.NewRecorder()
+	daysHandler(db)(w, httptest.NewRequest("GET", "/api/days?from=2025-05-30&to=2025-06-01", nil))
+
+	want := `[{"date":"2025-05-31","work":5400,"rest":1800,"workShare":0.75}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("daysHandler(), want: %s, got: %s", want, got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("daysHandler() content type, want: application/json, got: %s", got)
+	}
+}
+
+func Test_daysHandler_invalid(t *testing.T) {
+	for _, url := range []string{"/api/days", "/api/days?from=yesterday", "/api/days?from=2025-05-30&to=x"} {
+		w := httptest.NewRecorder()
+		daysHandler(createDB(t))(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("daysHandler(%s), want: %d, got: %d", url, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	daysHandler(nil)(w, httptest.NewRequest("GET", "/api/days?from=2025-05-30", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("daysHandler() without database, want: %d, got: %d", http.StatusNotFound, w.Code)
+	}
+}
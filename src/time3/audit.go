@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AuditEntry records a single State mutation: who requested it, the request
+// itself, and the State before and after it.
+type AuditEntry struct {
+	Time      time.Time      `json:"time"`
+	IP        string         `json:"ip"`
+	UserAgent string         `json:"userAgent"`
+	Client    string         `json:"client,omitempty"` // Token name or the 'X-Time3-Client' header.
+	Request   *JsonRequest   `json:"request"`
+	Before    *StateSnapshot `json:"before"`
+	After     *StateSnapshot `json:"after"`
+}
+
+// Appends the entry to the audit log.
+func (db *Database) LogAudit(e *AuditEntry) error {
+	request, err := json.Marshal(e.Request)
+	if err != nil {
+		return err
+	}
+	before, err := json.Marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(e.After)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec(
+		`insert into audit(time, ip, user_agent, client, request, before, after) values (?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixMilli(), e.IP, e.UserAgent, e.Client, request, before, after)
+	return err
+}
+
+// Returns up to 'limit' audit entries logged within [from, to], most recent first.
+func (db *Database) ReadAudit(from, to time.Time, limit int) ([]AuditEntry, error) {
+	rows, err := db.db.Query(`
+		select time, ip, user_agent, client, request, before, after from audit
+		where time >= ? and time <= ? order by time desc, id desc limit ?`,
+		from.UnixMilli(), to.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]AuditEntry, 0)
+	for rows.Next() {
+		var e AuditEntry
+		var millis int64
+		var request, before, after []byte
+		if err := rows.Scan(&millis, &e.IP, &e.UserAgent, &e.Client, &request, &before, &after); err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(millis)
+		for _, v := range []struct {
+			data []byte
+			dest any
+		}{{request, &e.Request}, {before, &e.Before}, {after, &e.After}} {
+			if err := json.Unmarshal(v.data, v.dest); err != nil {
+				return nil, fmt.Errorf("Error while unmarshalling: %v", err)
+			}
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// Appends the State mutation requested by 'host' to the audit log, if the
+// database is enabled.
+func logAudit(host HostInfo, request *JsonRequest, before, after *StateSnapshot) {
+	if db == nil {
+		return
+	}
+	e := AuditEntry{Time: clock.Now(), IP: host.ip, UserAgent: host.userAgent, Client: host.client,
+		Request: request, Before: before, After: after}
+	if err := db.LogAudit(&e); err != nil {
+		slog.Error("failed to log the audit entry.", "err", err)
+		metrics.dbError("log_audit")
+	}
+}
+
+// Responds with JSON list of the audit entries, most recent first. The request can specify:
+//   - 'from', the start of the time range, defaults to the start of today
+//   - 'to', the end of the time range, defaults to now
+//   - 'n', the maximum number of entries, defaults to 100
+func auditHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+
+		params := r.URL.Query()
+		now := clock.Now()
+		from, to := dayStart(now), now
+		var err error
+		if params.Get("from") != "" {
+			if from, err = parseTime(params.Get("from"), false); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if params.Get("to") != "" {
+			if to, err = parseTime(params.Get("to"), true); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		n := parseInt(params.Get("n"), 100)
+		if n < 1 || n > 1000 {
+			http.Error(w, fmt.Sprintf("Invalid n: '%d'.", n), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := db.ReadAudit(from, to, n)
+		if err != nil {
+			slog.Error("failed to read the audit log.", "err", err)
+			metrics.dbError("read_audit")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, entries)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_handleJsonRequest_audit(t *testing.T) {
+	db = createDB(t)
+	defer func() { db = nil }()
+	saved := state.snapshot()
+	defer state.restore(saved)
+	state.restore(&StateSnapshot{Mode: "off", ModeStart: clock.Now()})
+
+	host := HostInfo{ip: "10.0.0.1", userAgent: "test", client: "laptop"}
+	handleJsonRequest(&JsonRequest{Mode: "work", Tag: "a"}, host)
+	// Requests not changing anything aren't logged.
+	handleJsonRequest(&JsonRequest{Mode: "work", Tag: "a"}, host)
+
+	entries, err := db.ReadAudit(clock.Now().Add(-time.Hour), clock.Now(), 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("db.ReadAudit(), want: 1 entry, got: %v, %v", entries, err)
+	}
+	e := entries[0]
+	if e.IP != "10.0.0.1" || e.UserAgent != "test" || e.Client != "laptop" || e.Request.Mode != "work" {
+		t.Errorf("db.ReadAudit(), want: the request from laptop, got: %+v", e)
+	}
+	if e.Before.Mode != "off" || e.After.Mode != "work" || e.After.Tag != "a" {
+		t.Errorf("db.ReadAudit(), want: off -> work, got: %+v, %+v", e.Before, e.After)
+	}
+}
+
+func Test_requestHost(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-Time3-Client", "phone")
+	if host := requestHost(r); host.client != "phone" || host.ip != "192.0.2.1" {
+		t.Errorf("requestHost(), want: phone at 192.0.2.1, got: %+v", host)
+	}
+
+	// The token name takes precedence over the header.
+	*authFlag = true
+	defer func() { *authFlag = false }()
+	db = createDB(t)
+	defer func() { db = nil }()
+	token, _ := db.AddToken("laptop", ScopeControl)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	var got HostInfo
+	requireScope(ScopeControl, func(w http.ResponseWriter, r *http.Request) {
+		got = requestHost(r)
+	})(httptest.NewRecorder(), r)
+	if got.client != "laptop" {
+		t.Errorf("requestHost(), want: laptop, got: %+v", got)
+	}
+}
+
+func Test_auditHandler(t *testing.T) {
+	db := createDB(t)
+	snapshot := &StateSnapshot{Mode: "off", ModeStart: clock.Now()}
+	for _, d := range []time.Duration{-48 * time.Hour, -time.Minute} {
+		db.LogAudit(&AuditEntry{Time: clock.Now().Add(d), IP: "10.0.0.1", Request: &JsonRequest{Mode: "work"},
+			Before: snapshot, After: snapshot})
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", 1},
+		{"?from=2001-01-01", 2},
+		{"?from=2001-01-01&n=1", 1},
+		{"?to=" + clock.Now().Add(-time.Hour).Format(time.RFC3339), 0},
+	} {
+		w := httptest.NewRecorder()
+		auditHandler(db)(w, httptest.NewRequest("GET", "/api/audit"+tc.query, nil))
+		var got []AuditEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != tc.want {
+			t.Errorf("auditHandler(%s), want: %d entries, got: %v, %v", tc.query, tc.want, got, err)
+		}
+	}
+
+	for _, query := range []string{"?from=argh", "?n=0"} {
+		w := httptest.NewRecorder()
+		auditHandler(db)(w, httptest.NewRequest("GET", "/api/audit"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("auditHandler(%s), want: 400, got: %d", query, w.Code)
+		}
+	}
+}
+
+func Test_handleJsonRequest_auditSchedule(t *testing.T) {
+	schedules["test"] = &Schedule{Name: "test", Work: 10 * time.Minute, Rest: 2 * time.Minute}
+	defer delete(schedules, "test")
+	db = createDB(t)
+	defer func() { db = nil }()
+	saved := state.snapshot()
+	defer func() {
+		state.Lock()
+		state.controlScheduleLocked("stop")
+		state.Unlock()
+		state.restore(saved)
+	}()
+	state.restore(&StateSnapshot{Mode: "work", ModeStart: clock.Now()})
+
+	// Neither changes the mode, but both change the State.
+	handleJsonRequest(&JsonRequest{Schedule: "test"}, HostInfo{})
+	handleJsonRequest(&JsonRequest{Schedule: "stop"}, HostInfo{})
+	// Nothing to stop anymore.
+	handleJsonRequest(&JsonRequest{Schedule: "stop"}, HostInfo{})
+
+	entries, err := db.ReadAudit(clock.Now().Add(-time.Hour), clock.Now(), 10)
+	if err != nil || len(entries) != 2 || entries[0].Request.Schedule != "stop" || entries[1].Request.Schedule != "test" {
+		t.Errorf("db.ReadAudit(), want: 2 schedule entries, got: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Scope is an enum representing what an API token allows.
+type Scope int
+
+const (
+	ScopeRead    Scope = iota // Viewing the state and history, receiving broadcasts.
+	ScopeControl              // Everything above, plus changing the state.
+)
+
+// Returns a string representation of a given Scope.
+func (s Scope) toString() string {
+	if s < 0 || s > 1 {
+		return "unknown"
+	}
+	return []string{"read", "control"}[s]
+}
+
+// Returns a *Scope for a given string, or nil for invalid strings.
+func scopeFromString(str string) *Scope {
+	var result Scope
+	switch str {
+	case "read":
+		result = ScopeRead
+	case "control":
+		result = ScopeControl
+	default:
+		return nil
+	}
+	return &result
+}
+
+// TokenInfo describes an API token. The token itself is never stored.
+type TokenInfo struct {
+	Name    string
+	Scope   Scope
+	Created time.Time
+}
+
+// Returns the hash under which the token is stored in the database.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Creates a new random token with the given name and scope. Returns the token,
+// which is not recoverable later.
+func (db *Database) AddToken(name string, scope Scope) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("Token name is empty.")
+	}
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(bytes)
+
+	_, err := db.db.Exec(
+		`insert into tokens(hash, name, scope, created) values (?, ?, ?, ?)`,
+		hashToken(token), name, scope.toString(), clock.Now().UnixMilli())
+	if err != nil {
+		return "", fmt.Errorf("Cannot add token '%s': %v", name, err)
+	}
+	return token, nil
+}
+
+// Deletes the token with the given name.
+func (db *Database) RevokeToken(name string) error {
+	result, err := db.db.Exec(`delete from tokens where name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("Token '%s' not found.", name)
+	}
+	return nil
+}
+
+// Returns all the tokens, ordered by name.
+func (db *Database) ListTokens() ([]TokenInfo, error) {
+	rows, err := db.db.Query(`select name, scope, created from tokens order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]TokenInfo, 0)
+	for rows.Next() {
+		info, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *info)
+	}
+	return result, rows.Err()
+}
+
+// Returns the info for the token, or nil if the token doesn't exist.
+func (db *Database) LookupToken(token string) (*TokenInfo, error) {
+	row := db.db.QueryRow(`select name, scope, created from tokens where hash = ?`, hashToken(token))
+	info, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return info, err
+}
+
+func scanToken(row interface{ Scan(...any) error }) (*TokenInfo, error) {
+	var info TokenInfo
+	var scope string
+	var created int64
+	if err := row.Scan(&info.Name, &scope, &created); err != nil {
+		return nil, err
+	}
+	s := scopeFromString(scope)
+	if s == nil {
+		return nil, fmt.Errorf("Invalid scope for token '%s': '%s'.", info.Name, scope)
+	}
+	info.Scope = *s
+	info.Created = time.UnixMilli(created)
+	return &info, nil
+}
+
+// Returns 'true' if any of the token management flags is set.
+func tokenCommand() bool {
+	return *tokenAddFlag != "" || *tokenRevokeFlag != "" || *tokenListFlag
+}
+
+// Executes the token management command specified by the flags, and prints the
+// result to 'out'.
+func manageTokens(db *Database, out io.Writer) error {
+	switch {
+	case *tokenAddFlag != "":
+		scope := scopeFromString(*tokenScopeFlag)
+		if scope == nil {
+			return fmt.Errorf("Invalid scope: '%s'.", *tokenScopeFlag)
+		}
+		token, err := db.AddToken(*tokenAddFlag, *scope)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", token)
+	case *tokenRevokeFlag != "":
+		if err := db.RevokeToken(*tokenRevokeFlag); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked token '%s'.\n", *tokenRevokeFlag)
+	case *tokenListFlag:
+		tokens, err := db.ListTokens()
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			fmt.Fprintf(out, "%-20s %-8s %s\n", t.Name, t.Scope.toString(), t.Created.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Prefix of the websocket subprotocol carrying the token, as browsers can't set
+// headers on websocket connections.
+const tokenProtocolPrefix = "token."
+
+// Returns the token from the 'Authorization: Bearer' header, the 'token' query
+// parameter or the websocket subprotocol, or an empty string.
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, tokenProtocolPrefix) {
+			return strings.TrimPrefix(protocol, tokenProtocolPrefix)
+		}
+	}
+	return ""
+}
+
+// Key for storing the request's Scope in its context.
+type scopeKey struct{}
+
+// Key for storing the name of the request's token in its context.
+type clientKey struct{}
+
+// Returns 'true' if the request was granted at least the given scope. All
+// requests have all scopes when authentication is disabled.
+func hasScope(r *http.Request, scope Scope) bool {
+	if !*authFlag {
+		return true
+	}
+	granted, ok := r.Context().Value(scopeKey{}).(Scope)
+	return ok && granted >= scope
+}
+
+// Wraps the handler so that it's only called for requests with a valid token of
+// at least the given scope. The granted scope is available via hasScope().
+func requireScope(scope Scope, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !*authFlag {
+			handler(w, r)
+			return
+		}
+
+		token := tokenFromRequest(r)
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		info, err := db.LookupToken(token)
+		if err != nil {
+			slog.Error("token lookup failed.", "err", err)
+			metrics.dbError("lookup_token")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if info == nil {
+			host := getRemoteHost(r)
+			slog.Info("invalid token.", "host", &host)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if info.Scope < scope {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), scopeKey{}, info.Scope)
+		handler(w, r.WithContext(context.WithValue(ctx, clientKey{}, info.Name)))
+	}
+}
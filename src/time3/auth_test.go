@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Tokens(t *testing.T) {
+	db := createDB(t)
+
+	token, err := db.AddToken("viewer", ScopeRead)
+	if err != nil || len(token) != 32 {
+		t.Fatalf("db.AddToken(), want: 32 hex chars, got: %q, %v", token, err)
+	}
+	if _, err := db.AddToken("viewer", ScopeControl); err == nil {
+		t.Errorf("db.AddToken(), want: error for duplicate name, got: nil")
+	}
+
+	info, err := db.LookupToken(token)
+	if err != nil || info == nil || info.Name != "viewer" || info.Scope != ScopeRead {
+		t.Errorf("db.LookupToken(), want: viewer/read, got: %+v, %v", info, err)
+	}
+	if info, _ := db.LookupToken("bogus"); info != nil {
+		t.Errorf("db.LookupToken(), want: nil for unknown token, got: %+v", info)
+	}
+
+	db.AddToken("admin", ScopeControl)
+	tokens, _ := db.ListTokens()
+	if len(tokens) != 2 || tokens[0].Name != "admin" || tokens[1].Name != "viewer" {
+		t.Errorf("db.ListTokens(), want: [admin viewer], got: %+v", tokens)
+	}
+
+	if err := db.RevokeToken("viewer"); err != nil {
+		t.Errorf("db.RevokeToken(), unexpected error: %v", err)
+	}
+	if info, _ := db.LookupToken(token); info != nil {
+		t.Errorf("db.LookupToken(), want: nil for revoked token, got: %+v", info)
+	}
+	if err := db.RevokeToken("viewer"); err == nil {
+		t.Errorf("db.RevokeToken(), want: error for unknown name, got: nil")
+	}
+}
+
+func Test_Scope_toString(t *testing.T) {
+	for _, s := range []Scope{ScopeRead, ScopeControl} {
+		if got := scopeFromString(s.toString()); got == nil || *got != s {
+			t.Errorf("scopeFromString(%s), want: %v, got: %v", s.toString(), s, got)
+		}
+	}
+	if got := Scope(5).toString(); got != "unknown" {
+		t.Errorf("Scope(5).toString(), want: unknown, got: %s", got)
+	}
+	if got := scopeFromString("admin"); got != nil {
+		t.Errorf(`scopeFromString("admin"), want: nil, got: %v`, *got)
+	}
+}
+
+func Test_tokenFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer abc")
+	if got := tokenFromRequest(r); got != "abc" {
+		t.Errorf("tokenFromRequest(header), want: abc, got: %s", got)
+	}
+
+	r = httptest.NewRequest("GET", "/graph?token=def", nil)
+	if got := tokenFromRequest(r); got != "def" {
+		t.Errorf("tokenFromRequest(query), want: def, got: %s", got)
+	}
+
+	r = httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "time3, token.ghi")
+	if got := tokenFromRequest(r); got != "ghi" {
+		t.Errorf("tokenFromRequest(subprotocol), want: ghi, got: %s", got)
+	}
+
+	if got := tokenFromRequest(httptest.NewRequest("GET", "/", nil)); got != "" {
+		t.Errorf("tokenFromRequest(), want: empty, got: %s", got)
+	}
+}
+
+func Test_requireScope(t *testing.T) {
+	*authFlag = true
+	defer func() { *authFlag = false }()
+
+	db = createDB(t)
+	defer func() { db = nil }()
+	viewer, _ := db.AddToken("viewer", ScopeRead)
+	controller, _ := db.AddToken("controller", ScopeControl)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if hasScope(r, ScopeControl) {
+			w.Write([]byte("control"))
+		} else {
+			w.Write([]byte("read"))
+		}
+	}
+
+	for _, tc := range []struct {
+		scope    Scope
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{ScopeRead, "", http.StatusUnauthorized, "Unauthorized"},
+		{ScopeRead, "bogus", http.StatusUnauthorized, "Unauthorized"},
+		{ScopeRead, viewer, http.StatusOK, "read"},
+		{ScopeRead, controller, http.StatusOK, "control"},
+		{ScopeControl, viewer, http.StatusForbidden, "Forbidden"},
+		{ScopeControl, controller, http.StatusOK, "control"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/?token="+tc.token, nil)
+		requireScope(tc.scope, handler)(w, r)
+		if w.Code != tc.wantCode || strings.TrimSpace(w.Body.String()) != tc.wantBody {
+			t.Errorf("requireScope(%s) with token %q, want: %d %s, got: %d %s",
+				tc.scope.toString(), tc.token, tc.wantCode, tc.wantBody, w.Code, w.Body.String())
+		}
+	}
+}
+
+func Test_mainPageHandler_readOnly(t *testing.T) {
+	*authFlag = true
+	defer func() { *authFlag = false }()
+
+	db = createDB(t)
+	defer func() { db = nil }()
+	viewer, _ := db.AddToken("viewer", ScopeRead)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"mode": "work"}`))
+	r.Header.Set("Authorization", "Bearer "+viewer)
+	requireScope(ScopeRead, mainPageHandler)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("mainPageHandler(), want: %d, got: %d", http.StatusForbidden, w.Code)
+	}
+	if state.mode != Off {
+		t.Errorf("mainPageHandler(), want the state unchanged, got: %s", &state)
+	}
+}
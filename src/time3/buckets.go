@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Bucket is the period of time aggregated into a single bar of the graph.
+type bucket struct {
+	name  string
+	days  int    // Approximate length, to limit the number of bars.
+	sql   string // Expression for the bucket's first date, given the 'date' column.
+	start func(t time.Time) time.Time
+	next  func(t time.Time) time.Time
+	label func(date string) string
+}
+
+var (
+	dayBucket = &bucket{
+		name:  "day",
+		days:  1,
+		sql:   "date",
+		start: func(t time.Time) time.Time { return t },
+		next:  func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+		label: func(date string) string { return date[5:] }, // 'mm-dd'
+	}
+	// ISO weeks start on Monday.
+	weekBucket = &bucket{
+		name:  "week",
+		days:  7,
+		sql:   "date(date, '-' || ((cast(strftime('%w', date) as integer) + 6) % 7) || ' days')",
+		start: func(t time.Time) time.Time { return t.AddDate(0, 0, -(int(t.Weekday())+6)%7) },
+		next:  func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+		label: func(date string) string {
+			t, _ := time.Parse(time.DateOnly, date)
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		},
+	}
+	monthBucket = &bucket{
+		name:  "month",
+		days:  31,
+		sql:   "strftime('%Y-%m-01', date)",
+		start: func(t time.Time) time.Time { return t.AddDate(0, 0, 1-t.Day()) },
+		next:  func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+		label: func(date string) string { return date[:7] }, // 'yyyy-mm'
+	}
+)
+
+var buckets = map[string]*bucket{"day": dayBucket, "week": weekBucket, "month": monthBucket}
+
+// Maximum number of bars in a graph, and of days in the plotted range.
+const (
+	maxBars = 366
+	maxDays = 10 * 366
+)
+
+// Picks the bucket for plotting the number of days: daily bars for up to a
+// month, weekly bars for up to half a year, and monthly bars otherwise.
+func autoBucket(days int) *bucket {
+	switch {
+	case days <= 31:
+		return dayBucket
+	case days <= 190:
+		return weekBucket
+	default:
+		return monthBucket
+	}
+}
+
+// Returns the named bucket for plotting the number of days, 'auto' or empty
+// name picks one depending on the number of days.
+func parseBucket(name string, days int) (*bucket, error) {
+	if name == "" || name == "auto" {
+		return autoBucket(days), nil
+	}
+	b := buckets[name]
+	if b == nil {
+		return nil, fmt.Errorf("Invalid bucket: '%s'.", name)
+	}
+	if days/b.days > maxBars {
+		return nil, fmt.Errorf("Too many bars for bucket '%s': %d days.", name, days)
+	}
+	return b, nil
+}
+
+// Returns the totals for days between dates t1 and t2 (inclusive), summed per
+// bucket. The Date of each total is the first date of its bucket, which can be
+// before t1 (only the days from t1 on are summed).
+func (db *Database) ReadBuckets(t1, t2 string, b *bucket) ([]DayTotal, error) {
+	query := fmt.Sprintf(`select %s as bucket, sum(work), sum(rest) from days
+		where date >= ? and date <= ? group by bucket order by bucket`, b.sql)
+	rows, err := db.db.Query(query, t1, t2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]DayTotal, 0)
+	for rows.Next() {
+		var date string
+		var work float64 // Stored in seconds.
+		var rest float64
+		if err := rows.Scan(&date, &work, &rest); err != nil {
+			return nil, err
+		}
+		result = append(result, DayTotal{
+			Date: date,
+			Work: time.Duration(work * float64(time.Second)),
+			Rest: time.Duration(rest * float64(time.Second)),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := db.readBreakdown(tagBreakdown, b, t1, t2, result, func(d *DayTotal) *map[string]time.Duration {
+		return &d.Tags
+	}); err != nil {
+		return nil, err
+	}
+	return result, db.readBreakdown(modeBreakdown, b, t1, t2, result, func(d *DayTotal) *map[string]time.Duration {
+		return &d.Modes
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseBucket(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		days int
+		want *bucket
+	}{
+		{"", 7, dayBucket},
+		{"auto", 90, weekBucket},
+		{"auto", 3 * 365, monthBucket},
+		{"day", 90, dayBucket},
+		{"month", 7, monthBucket},
+	} {
+		if got, err := parseBucket(tc.name, tc.days); err != nil || got != tc.want {
+			t.Errorf("parseBucket(%s, %d), want: %s, got: %v, %v", tc.name, tc.days, tc.want.name, got, err)
+		}
+	}
+
+	if _, err := parseBucket("year", 7); err == nil {
+		t.Errorf("parseBucket(year), want: error, got: nil")
+	}
+	if _, err := parseBucket("day", 2*365); err == nil {
+		t.Errorf("parseBucket(day), want: error for too many bars, got: nil")
+	}
+}
+
+func Test_daysBetween(t *testing.T) {
+	if got, err := daysBetween("2025-05-31", "2025-06-02"); err != nil || got != 3 {
+		t.Errorf("daysBetween(), want: 3, got: %v, %v", got, err)
+	}
+	for _, tc := range []struct{ from, to, want string }{
+		{"2025-13-01", "2025-06-02", "Invalid from: '2025-13-01'."},
+		{"2025-05-31", "2025-6-2", "Invalid to: '2025-6-2'."},
+	} {
+		if _, err := daysBetween(tc.from, tc.to); err == nil || err.Error() != tc.want {
+			t.Errorf("daysBetween(%s, %s), want: %s, got: %v", tc.from, tc.to, tc.want, err)
+		}
+	}
+}
+
+func Test_newOptions_invalid(t *testing.T) {
+	if _, err := newOptions("2025-05-31", 1, 400, 50); err == nil || err.Error() != "Invalid height: '50'." {
+		t.Errorf("newOptions(), want: invalid height, got: %v", err)
+	}
+}
+
+func Test_ReadBuckets_week(t *testing.T) {
+	db := createDB(t)
+	db.ImportDays([]DayTotal{
+		{Date: "2025-06-01", Work: time.Hour}, // Sunday, before the range.
+		{Date: "2025-06-02", Work: time.Hour, Tags: map[string]time.Duration{"a": time.Hour}},
+		{Date: "2025-06-08", Work: 2 * time.Hour, Rest: time.Hour, Tags: map[string]time.Duration{"a": time.Hour}},
+		{Date: "2025-06-09", Rest: time.Hour},
+	}, true)
+
+	got, err := db.ReadBuckets("2025-06-01", "2025-06-09", weekBucket)
+	want := []DayTotal{
+		{Date: "2025-05-26", Work: time.Hour},
+		{Date: "2025-06-02", Work: 3 * time.Hour, Rest: time.Hour, Tags: map[string]time.Duration{"a": 2 * time.Hour}},
+		{Date: "2025-06-09", Rest: time.Hour},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("db.ReadBuckets(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	// Only the days within the range are summed, even if the week starts earlier.
+	got, _ = db.ReadBuckets("2025-06-03", "2025-06-08", weekBucket)
+	want = []DayTotal{{Date: "2025-06-02", Work: 2 * time.Hour, Rest: time.Hour,
+		Tags: map[string]time.Duration{"a": time.Hour}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("db.ReadBuckets(), want: %v, got: %v", want, got)
+	}
+}
+
+func Test_newDailyChart_month(t *testing.T) {
+	db := createDB(t)
+	db.ImportDays([]DayTotal{
+		{Date: "2024-12-31", Work: time.Hour},
+		{Date: "2025-01-01", Work: time.Hour},
+		{Date: "2025-01-31", Work: time.Hour, Rest: time.Hour},
+	}, true)
+
+	opts, _ := newOptions("2025-03-15", 120, 400, 300)
+	opts.bucket = monthBucket
+	c := newDailyChart(db, opts)
+	if want := []string{"2024-11", "2024-12", "2025-01", "2025-02", "2025-03"}; !reflect.DeepEqual(c.labels, want) {
+		t.Errorf("newDailyChart().labels, want: %v, got: %v", want, c.labels)
+	}
+	if want := [][]float64{{0, 0}, {1, 0}, {2, 1}, {0, 0}, {0, 0}}; !reflect.DeepEqual(c.values, want) {
+		t.Errorf("newDailyChart().values, want: %v, got: %v", want, c.values)
+	}
+}
+
+func Test_weekBucket_label(t *testing.T) {
+	// 2024-12-30 is in the first ISO week of 2025.
+	if got := weekBucket.label("2024-12-30"); got != "2025-W01" {
+		t.Errorf("weekBucket.label(), want: 2025-W01, got: %s", got)
+	}
+	start, _ := time.Parse(time.DateOnly, "2025-01-05")
+	if got := weekBucket.start(start).Format(time.DateOnly); got != "2024-12-30" {
+		t.Errorf("weekBucket.start(), want: 2024-12-30, got: %s", got)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// Colors matching the ones in 'daily_totals_template.gnuplot'.
+var (
+	backgroundColor = parseColor("#d5cdb6")
+	workColor       = parseColor("#0072d4")
+	restColor       = parseColor("#489100")
+	black           = color.RGBA{0, 0, 0, 255}
+)
+
+// Parses a color in '#rrggbb' format, returns black for invalid strings.
+func parseColor(s string) color.RGBA {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return black
+	}
+	return color.RGBA{r, g, b, 255}
+}
+
+// Series is a named, colored part of each stacked bar.
+type series struct {
+	name  string
+	color color.RGBA
+}
+
+// Chart is a stacked bar chart, with one bar per label.
+type chart struct {
+	width  int
+	height int
+	yLabel string
+	series []series    // Bottom to top stacking order.
+	labels []string    // X-axis label for each bar.
+	values [][]float64 // values[i][j] is the value of series 'j' in bar 'i'.
+}
+
+// Horizontal alignment of text relative to its anchor point.
+type anchor int
+
+const (
+	alignLeft anchor = iota
+	alignCenter
+	alignRight
+)
+
+// Canvas abstracts the drawing primitives used for rendering a chart.
+type canvas interface {
+	// Draws a filled rectangle with a black border.
+	rect(x, y, w, h int, fill color.RGBA)
+	// Draws a horizontal or vertical line.
+	line(x1, y1, x2, y2 int, c color.RGBA)
+	// Draws text with its top edge at 'y'. Vertical text reads bottom to top,
+	// is centered on 'x' and ends at 'y'.
+	text(x, y int, s string, a anchor, vertical bool)
+}
+
+// Scale of the bitmap font for the given image height.
+func fontScale(height int) int {
+	if height < 200 {
+		return 1
+	}
+	return 2
+}
+
+// Returns the tick step and the maximum value of the Y axis, so that it has
+// a reasonable amount of ticks at "round" values.
+func yAxis(highest float64) (step, top float64) {
+	if highest <= 0 {
+		return 1, 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(highest)))
+	for _, m := range []float64{0.1, 0.2, 0.5, 1, 2, 5, 10} {
+		step = m * magnitude
+		if highest/step <= 8 {
+			break
+		}
+	}
+	return step, math.Ceil(highest/step) * step
+}
+
+// Formats the Y axis tick value without unnecessary decimals.
+func formatTick(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
+
+// Renders the chart on the canvas.
+func (c *chart) draw(cv canvas) {
+	scale := fontScale(c.height)
+	charW, charH := (glyphWidth+1)*scale, glyphHeight*scale
+	pad := charH
+
+	highest := 0.0
+	for _, bar := range c.values {
+		sum := 0.0
+		for _, v := range bar {
+			sum += v
+		}
+		highest = max(highest, sum)
+	}
+	step, top := yAxis(highest)
+
+	var ticks []string
+	labelWidth, xLabelLength := 0, 0
+	for v := 0.0; v <= top+step/2; v += step {
+		ticks = append(ticks, formatTick(v))
+		labelWidth = max(labelWidth, len(ticks[len(ticks)-1])*charW)
+	}
+	for _, l := range c.labels {
+		xLabelLength = max(xLabelLength, len(l)*charW)
+	}
+
+	// Plot area boundaries.
+	left := pad + labelWidth
+	right := c.width - pad
+	upper := 2*pad + charH
+	bottom := c.height - pad - xLabelLength
+	plotW, plotH := max(right-left, 1), max(bottom-upper, 1)
+
+	// Y axis label and the key, above the plot area.
+	cv.text(left, pad/2, c.yLabel, alignLeft, false)
+	x := right
+	for _, s := range c.series {
+		cv.rect(x-2*charW, pad/2, 2*charW, charH, s.color)
+		x -= 2*charW + charW/2
+		cv.text(x, pad/2, s.name, alignRight, false)
+		x -= len(s.name)*charW + 2*charW
+	}
+
+	// Y axis ticks, mirrored on both sides.
+	for i, t := range ticks {
+		y := bottom - int(float64(i)*step/top*float64(plotH))
+		cv.line(left, y, left+pad/2, y, black)
+		cv.line(right-pad/2, y, right, y, black)
+		cv.text(left-charW/2, y-charH/2, t, alignRight, false)
+	}
+
+	// Stacked bars, and their X axis labels.
+	slot := float64(plotW) / float64(max(len(c.labels), 1))
+	barW := max(int(slot/2), 1)
+	every := int(math.Ceil(float64(charH+scale) / slot)) // Skip labels which don't fit.
+	for i, bar := range c.values {
+		center := left + int((float64(i)+0.5)*slot)
+		y := float64(bottom)
+		for j, v := range bar {
+			h := v / top * float64(plotH)
+			if h > 0 {
+				cv.rect(center-barW/2, int(math.Round(y-h)), barW, int(math.Round(y))-int(math.Round(y-h)), c.series[j].color)
+			}
+			y -= h
+		}
+		if i%every == 0 {
+			cv.line(center, bottom-pad/2, center, bottom, black)
+			cv.text(center, bottom+pad/2, c.labels[i], alignRight, true)
+		}
+	}
+
+	// Frame around the plot area.
+	cv.line(left, upper, right, upper, black)
+	cv.line(left, bottom, right, bottom, black)
+	cv.line(left, upper, left, bottom, black)
+	cv.line(right, upper, right, bottom, black)
+}
+
+// Renders the chart as PNG image.
+func (c *chart) png() ([]byte, error) {
+	cv := pngCanvas{
+		img:   image.NewRGBA(image.Rect(0, 0, c.width, c.height)),
+		scale: fontScale(c.height),
+	}
+	draw.Draw(cv.img, cv.img.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+	c.draw(&cv)
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, cv.img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Renders the chart as SVG image.
+func (c *chart) svg() []byte {
+	var cv svgCanvas
+	fmt.Fprintf(&cv.buffer,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="%d">`+"\n",
+		c.width, c.height, (glyphHeight+2)*fontScale(c.height))
+	fmt.Fprintf(&cv.buffer, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(backgroundColor))
+	c.draw(&cv)
+	cv.buffer.WriteString("</svg>\n")
+	return cv.buffer.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// pngCanvas draws on an in-memory image, using the bitmap font for text.
+type pngCanvas struct {
+	img   *image.RGBA
+	scale int
+}
+
+func (cv *pngCanvas) fill(x, y, w, h int, c color.RGBA) {
+	draw.Draw(cv.img, image.Rect(x, y, x+w, y+h), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func (cv *pngCanvas) rect(x, y, w, h int, fill color.RGBA) {
+	cv.fill(x, y, w, h, black)
+	cv.fill(x+1, y+1, w-2, h-2, fill)
+}
+
+func (cv *pngCanvas) line(x1, y1, x2, y2 int, c color.RGBA) {
+	cv.fill(min(x1, x2), min(y1, y2), abs(x2-x1)+1, abs(y2-y1)+1, c)
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func (cv *pngCanvas) text(x, y int, s string, a anchor, vertical bool) {
+	s = strings.ToValidUTF8(s, "?")
+	advance := (glyphWidth + 1) * cv.scale
+	length := len([]rune(s))*advance - cv.scale // No spacing after the last glyph.
+	height := glyphHeight * cv.scale
+
+	if vertical {
+		// Anchor is always the end of the text for vertical text.
+		x -= height / 2
+	} else if a == alignCenter {
+		x -= length / 2
+	} else if a == alignRight {
+		x -= length
+	}
+
+	for i, r := range []rune(s) {
+		g := glyphFor(r)
+		for row := range glyphHeight {
+			for col := range glyphWidth {
+				if g[row][col] != '1' {
+					continue
+				}
+				// Position of the pixel in the unrotated text.
+				px, py := i*advance+col*cv.scale, row*cv.scale
+				if vertical {
+					// Rotate 90 degrees counter-clockwise.
+					px, py = py, length-px-cv.scale
+				}
+				cv.fill(x+px, y+py, cv.scale, cv.scale, black)
+			}
+		}
+	}
+}
+
+// svgCanvas accumulates SVG elements in a buffer.
+type svgCanvas struct {
+	buffer bytes.Buffer
+}
+
+func (cv *svgCanvas) rect(x, y, w, h int, fill color.RGBA) {
+	fmt.Fprintf(&cv.buffer,
+		`<rect x="%d.5" y="%d.5" width="%d" height="%d" fill="%s" stroke="black"/>`+"\n",
+		x, y, w-1, h-1, hexColor(fill))
+}
+
+func (cv *svgCanvas) line(x1, y1, x2, y2 int, c color.RGBA) {
+	fmt.Fprintf(&cv.buffer,
+		`<line x1="%d.5" y1="%d.5" x2="%d.5" y2="%d.5" stroke="%s"/>`+"\n",
+		x1, y1, x2, y2, hexColor(c))
+}
+
+func (cv *svgCanvas) text(x, y int, s string, a anchor, vertical bool) {
+	textAnchor := []string{"start", "middle", "end"}[a]
+	if vertical {
+		fmt.Fprintf(&cv.buffer,
+			`<text transform="translate(%d,%d) rotate(-90)" text-anchor="end" dominant-baseline="central">%s</text>`+"\n",
+			x, y, html.EscapeString(s))
+		return
+	}
+	fmt.Fprintf(&cv.buffer,
+		`<text x="%d" y="%d" text-anchor="%s" dominant-baseline="hanging">%s</text>`+"\n",
+		x, y, textAnchor, html.EscapeString(s))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_yAxis(t *testing.T) {
+	for _, tc := range []struct{ max, step, top float64 }{
+		{0, 1, 1},
+		{0.3, 0.05, 0.3},
+		{7.5, 1, 8},
+		{11.3, 2, 12},
+		{95, 20, 100},
+	} {
+		step, top := yAxis(tc.max)
+		if math.Abs(step-tc.step) > 1e-9 || math.Abs(top-tc.top) > 1e-9 {
+			t.Errorf("yAxis(%v), want: %v, %v, got: %v, %v", tc.max, tc.step, tc.top, step, top)
+		}
+	}
+}
+
+func Test_parseColor(t *testing.T) {
+	got := hexColor(parseColor("#0072d4"))
+	if got != "#0072d4" {
+		t.Errorf("parseColor(), want: #0072d4, got: %s", got)
+	}
+	if parseColor("blue") != black {
+		t.Errorf("parseColor(), want: black for invalid color")
+	}
+}
+
+func Test_newDailyChart(t *testing.T) {
+	db := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	db.StoreValue(now, 2*time.Hour, 30*time.Minute)
+
+	opts, _ := newOptions("2025-06-01", 3, 400, 300)
+	c := newDailyChart(db, opts)
+
+	wantLabels := []string{"05-30", "05-31", "06-01"}
+	if strings.Join(c.labels, ",") != strings.Join(wantLabels, ",") {
+		t.Errorf("newDailyChart().labels, want: %v, got: %v", wantLabels, c.labels)
+	}
+	if v := c.values[1]; v[0] != 2 || v[1] != 0.5 {
+		t.Errorf("newDailyChart().values, want: [2 0.5], got: %v", v)
+	}
+	if v := c.values[0]; v[0] != 0 || v[1] != 0 {
+		t.Errorf("newDailyChart().values, want: [0 0], got: %v", v)
+	}
+}
+
+func Test_chart_png(t *testing.T) {
+	c := chart{
+		width:  400,
+		height: 300,
+		yLabel: "hours",
+		series: []series{{"work", workColor}, {"rest", restColor}},
+		labels: []string{"05-31"},
+		values: [][]float64{{3, 1}},
+	}
+	data, err := c.png()
+	if err != nil {
+		t.Fatalf("chart.png(), unexpected error: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode(), unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 400 || b.Dy() != 300 {
+		t.Errorf("chart.png() size, want: 400x300, got: %dx%d", b.Dx(), b.Dy())
+	}
+
+	seen := map[string]int{}
+	for x := range 400 {
+		for y := range 300 {
+			r, g, b, _ := img.At(x, y).RGBA()
+			seen[hexColor(color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255})]++
+		}
+	}
+	// The work part of the bar is 3 times bigger than the rest part.
+	work, rest := seen[hexColor(workColor)], seen[hexColor(restColor)]
+	if work < 2*rest || rest == 0 || seen[hexColor(backgroundColor)] == 0 {
+		t.Errorf("chart.png(), unexpected colors: %v", seen)
+	}
+}
+
+func Test_chart_svg(t *testing.T) {
+	c := chart{
+		width:  400,
+		height: 300,
+		yLabel: "hours",
+		series: []series{{"work", workColor}, {"rest", restColor}},
+		labels: []string{"05-31"},
+		values: [][]float64{{3, 1}},
+	}
+	got := string(c.svg())
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="400" height="300"`,
+		`fill="#0072d4"`,
+		`fill="#489100"`,
+		`>hours</text>`,
+		`>05-31</text>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("chart.svg(), want to contain: %s, got:\n%s", want, got)
+		}
+	}
+}
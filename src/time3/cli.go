@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subcommands of the command-line client, talking to a running server.
+var clientCommands = map[string]string{
+	"status": "Print the current state.",
+	"work":   "Switch to the 'work' mode, with an optional tag: 'time3 work [tag]'.",
+	"rest":   "Switch to the 'rest' mode, optionally backdated: 'time3 rest -ago=15m'.",
+	"off":    "Switch to the 'off' mode.",
+	"patch":  "Patch the work/rest durations: 'time3 patch -work=+10m -rest=-5m'.",
+	"undo":   "Undo the most recent mode change or duration patch.",
+	"redo":   "Redo the most recently undone change.",
+	"watch":  "Print the state changes as they happen, until interrupted.",
+}
+
+// Client talks to a running server with the same JsonRequest protocol, that
+// the web page uses.
+type Client struct {
+	server *url.URL // Base URL, like 'http://localhost:37177'.
+	token  string   // API token, if the server runs with '-auth'.
+	http   *http.Client
+}
+
+// StateJson is the State, as sent by the server in State.toJson().
+type StateJson struct {
+	Event     string             `json:"event"` // Set for the non-State messages, like "countdown".
+	Mode      string             `json:"mode"`
+	Work      float64            `json:"work"`      // Seconds, without the current session.
+	Rest      float64            `json:"rest"`      // Seconds, without the current session.
+	ModeStart int64              `json:"modeStart"` // Milliseconds ago.
+	Tag       string             `json:"tag"`
+	Tags      map[string]float64 `json:"tags"`
+	Ratio     float64            `json:"ratio"`
+	Earned    float64            `json:"earned"`
+	Schedule  *struct {
+		Name  string `json:"name"`
+		Cycle int    `json:"cycle"`
+		Next  string `json:"next"`
+		In    int64  `json:"in"`
+	} `json:"schedule"`
+	Next string `json:"next"` // Mode after the "countdown".
+	In   int64  `json:"in"`   // Milliseconds until the "countdown" transition.
+}
+
+// Returns 'true' if the binary is run as a command-line client.
+func isClientCommand(args []string) bool {
+	return len(args) > 0 && clientCommands[args[0]] != ""
+}
+
+// Runs the client subcommand in 'args' (without the binary name), and prints
+// the result to 'out'.
+func runClient(args []string, out io.Writer) error {
+	command := args[0]
+	flags := flag.NewFlagSet("time3 "+command, flag.ContinueOnError)
+	flags.SetOutput(out)
+	server := flags.String("server", "http://localhost:37177", "Base URL of the time3 server.")
+	token := flags.String("token", os.Getenv("TIME3_TOKEN"), "API token, when the server runs with '-auth'."+
+		" Defaults to the TIME3_TOKEN environment variable.")
+	var work, rest, ago *string
+	switch command {
+	case "work", "rest", "off":
+		ago = flags.String("ago", "", "Backdate the mode change, like '15m' for 15 minutes ago.")
+	case "patch":
+		work = flags.String("work", "", "Work duration patch, like '+10m' or '-5m'.")
+		rest = flags.String("rest", "", "Rest duration patch, like '+10m' or '-5m'.")
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(out, "%s\n\nUsage of 'time3 %s':\n", clientCommands[command], command)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Only 'work' takes an argument, the tag. The flags after it aren't parsed.
+	allowed := 0
+	if command == "work" {
+		allowed = 1
+	}
+	if flags.NArg() > allowed {
+		return fmt.Errorf("Unexpected arguments: %v, the flags go before the tag.", flags.Args()[allowed:])
+	}
+
+	u, err := url.Parse(*server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("Invalid server: '%s'.", *server)
+	}
+	client := Client{server: u, token: *token, http: &http.Client{Timeout: 10 * time.Second}}
+
+	var request JsonRequest
+	switch command {
+	case "status":
+		return client.status(out)
+	case "watch":
+		return client.watch(out)
+	case "work":
+		request = JsonRequest{Mode: command, Tag: flags.Arg(0), Ago: *ago}
+	case "rest", "off":
+		request = JsonRequest{Mode: command, Ago: *ago}
+	case "undo", "redo":
+		request = JsonRequest{Command: command}
+	case "patch":
+		for _, d := range []string{*work, *rest} {
+			if _, err := time.ParseDuration(d); d != "" && err != nil {
+				return fmt.Errorf("Invalid duration: '%s'.", d)
+			}
+		}
+		if *work == "" && *rest == "" {
+			return fmt.Errorf("Nothing to patch, specify '-work' and/or '-rest'.")
+		}
+		request = JsonRequest{Work: *work, Rest: *rest}
+	}
+
+	s, err := client.post(&request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, s.describe(time.Now()))
+	return nil
+}
+
+// Sends the request to the server, returns the resulting State.
+func (c *Client) post(request *JsonRequest) (*StateJson, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.server.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// The error is followed by the current State.
+		message, _, _ := strings.Cut(string(data), "\n")
+		return nil, fmt.Errorf("Request failed: %s (%s).", resp.Status, message)
+	}
+
+	var result StateJson
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling: %v", err)
+	}
+	return &result, nil
+}
+
+// Connects to the server's websocket, which sends the current State first.
+func (c *Client) dial() (*websocket.Conn, error) {
+	u := *c.server
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil && resp != nil {
+		return nil, fmt.Errorf("Cannot connect to %s: %s.", u.String(), resp.Status)
+	}
+	return conn, err
+}
+
+// Reads the next message from the websocket.
+func readState(conn *websocket.Conn) (*StateJson, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var result StateJson
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling: %v", err)
+	}
+	return &result, nil
+}
+
+// Prints the current State.
+func (c *Client) status(out io.Writer) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s, err := readState(conn)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, s.describe(time.Now()))
+	return nil
+}
+
+// Prints the State changes as they happen, until the connection is closed.
+func (c *Client) watch(out io.Writer) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		s, err := readState(conn)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		fmt.Fprintf(out, "%s  %s\n", now.Format(time.TimeOnly), s.describe(now))
+	}
+}
+
+// Rounds the seconds to a human-readable duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
+
+// Returns a human-readable, single-line description of the State at 'now'.
+func (s *StateJson) describe(now time.Time) string {
+	if s.Event == "countdown" {
+		return fmt.Sprintf("%s in %v", s.Next, (time.Duration(s.In) * time.Millisecond).Round(time.Second))
+	}
+
+	// The totals only include the current session for the built-in modes, as
+	// the categories of the user-defined ones are not sent.
+	elapsed := time.Duration(s.ModeStart) * time.Millisecond
+	work, rest := seconds(s.Work), seconds(s.Rest)
+	switch s.Mode {
+	case "work":
+		work += elapsed.Round(time.Second)
+	case "rest":
+		rest += elapsed.Round(time.Second)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s", s.Mode)
+	if s.Tag != "" {
+		fmt.Fprintf(&b, " [%s]", s.Tag)
+	}
+	fmt.Fprintf(&b, " since %s (%v)", now.Add(-elapsed).Format("15:04"), elapsed.Round(time.Second))
+	fmt.Fprintf(&b, ", work %v, rest %v", work, rest)
+	if s.Ratio > 0 {
+		// The server computes the earned rest at the time of the message.
+		fmt.Fprintf(&b, ", earned rest %v", seconds(s.Earned))
+	}
+	if s.Schedule != nil {
+		fmt.Fprintf(&b, ", %s: %s in %v", s.Schedule.Name, s.Schedule.Next,
+			(time.Duration(s.Schedule.In) * time.Millisecond).Round(time.Second))
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Starts a test server with the main page and the websocket handlers.
+func newTestServer(t *testing.T) string {
+	saved := state.snapshot()
+	t.Cleanup(func() { state.restore(saved) })
+	state.restore(&StateSnapshot{Work: time.Hour, Mode: "off", ModeStart: clock.Now()})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", mainPageHandler)
+	mux.HandleFunc("/ws", websocketHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func Test_runClient(t *testing.T) {
+	url := newTestServer(t)
+
+	var out strings.Builder
+	if err := runClient([]string{"work", "-server", url, "project"}, &out); err != nil {
+		t.Fatalf("runClient(work), unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "work [project] since ") || state.mode != Work || state.tag != "project" {
+		t.Errorf("runClient(work), want: work on 'project', got: %s", out.String())
+	}
+
+	out.Reset()
+	if err := runClient([]string{"patch", "-server", url, "--work=+10m"}, &out); err != nil {
+		t.Fatalf("runClient(patch), unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), ", work 1h10m0s, rest 0s") {
+		t.Errorf("runClient(patch), want: 1h10m of work, got: %s", out.String())
+	}
+
+	out.Reset()
+	if err := runClient([]string{"status", "-server", url}, &out); err != nil {
+		t.Fatalf("runClient(status), unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "work [project] since ") {
+		t.Errorf("runClient(status), want: work on 'project', got: %s", out.String())
+	}
+}
+
+func Test_runClient_invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"patch", "-work=argh"},
+		{"patch"},
+		{"status", "-server", "ftp://localhost"},
+		{"off", "-argh"},
+	} {
+		var out strings.Builder
+		if err := runClient(args, &out); err == nil {
+			t.Errorf("runClient(%v), want: error, got: nil", args)
+		}
+	}
+}
+
+func Test_runClient_extraArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"work", "project", "-ago=15m"},
+		{"work", "a", "b"},
+		{"rest", "-ago=5m", "argh"},
+		{"status", "argh"},
+	} {
+		var out strings.Builder
+		if err := runClient(args, &out); err == nil || !strings.Contains(err.Error(), "Unexpected arguments") {
+			t.Errorf("runClient(%v), want: 'Unexpected arguments' error, got: %v", args, err)
+		}
+	}
+}
+
+func Test_Client_post_forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		w.Write([]byte(`{"mode": "off"}`))
+	}))
+	defer server.Close()
+
+	err := runClient([]string{"rest", "-server", server.URL, "-token", "argh"}, &strings.Builder{})
+	if err == nil || !strings.Contains(err.Error(), "(Forbidden)") {
+		t.Errorf("runClient(rest), want: forbidden error, got: %v", err)
+	}
+}
+
+func Test_StateJson_describe(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2025-06-01T10:00:00Z")
+	s := StateJson{Mode: "rest", Work: 3600, Rest: 60, ModeStart: 120_000, Ratio: 3, Earned: 1140}
+	want := "rest since 09:58 (2m0s), work 1h0m0s, rest 3m0s, earned rest 19m0s"
+	if got := s.describe(now); got != want {
+		t.Errorf("describe(), want: %s, got: %s", want, got)
+	}
+
+	s = StateJson{Event: "countdown", Next: "work", In: 59_600}
+	if got := s.describe(now); got != "work in 1m0s" {
+		t.Errorf("describe(), want: work in 1m0s, got: %s", got)
+	}
+}
+
+func Test_isClientCommand(t *testing.T) {
+	if !isClientCommand([]string{"watch"}) || isClientCommand([]string{"-db", "x"}) || isClientCommand(nil) {
+		t.Errorf("isClientCommand(), want: only for the subcommands")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -10,47 +11,188 @@ import (
 // WsClient is a mutex-protected pointer to `websocket.Conn`.
 type WsClient struct {
 	sync.Mutex
-	conn *websocket.Conn
+	conn        *websocket.Conn
+	connectedAt time.Time
+	remoteAddr  string
+	userAgent   string
 }
 
-// Writes the message to underlying `websocket.Conn` in a thread-safe way.
+// Writes the message to underlying `websocket.Conn` in a thread-safe way. Fails
+// if the write doesn't complete within '-ws-write-timeout'.
 func (client *WsClient) send(msg string) error {
 	client.Lock()
 	defer client.Unlock()
+	if err := client.conn.SetWriteDeadline(time.Now().Add(*wsWriteTimeoutFlag)); err != nil {
+		return err
+	}
 	return client.conn.WriteMessage(websocket.TextMessage, []byte(msg))
 }
 
-// WsClients is a mutex-protected set of all connected websocket clients.
+// Sends a ping, the client is expected to respond with a pong.
+func (client *WsClient) ping() error {
+	client.Lock()
+	defer client.Unlock()
+	return client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(*wsWriteTimeoutFlag))
+}
+
+// Pings the client every 'interval', until 'done' is closed. The connection is
+// closed when a ping fails, so that the reads fail too.
+func (client *WsClient) keepalive(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := client.ping(); err != nil {
+				slog.Info("websocket ping failed, closing.", "remote", client.remoteAddr, "error", err)
+				client.close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Closes the connection, the handler's read loop then ends.
+func (client *WsClient) close() {
+	if client.conn != nil {
+		client.conn.Close()
+	}
+}
+
+// Receives the broadcast messages, along with their event ids.
+func (client *WsClient) notify(_ uint64, msg string) error {
+	return client.send(msg)
+}
+
+func (client *WsClient) info() ClientInfo {
+	return ClientInfo{Kind: "websocket", RemoteAddr: client.remoteAddr, UserAgent: client.userAgent,
+		ConnectedAt: client.connectedAt}
+}
+
+// Subscriber is a connected client receiving the broadcast messages, either a
+// websocket or a Server-Sent Events client.
+type subscriber interface {
+	notify(id uint64, msg string) error
+	// Describes the client, for the admin page.
+	info() ClientInfo
+	// Disconnects the client, e.g. when it stopped responding.
+	close()
+}
+
+// ClientInfo describes a connected client.
+type ClientInfo struct {
+	Id          int       `json:"id"`
+	Kind        string    `json:"kind"` // Either "websocket" or "sse".
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// Event is a broadcast message with its sequential id, 0 for transient messages.
+type event struct {
+	id  uint64
+	msg string
+}
+
+// Number of the most recent events kept for resuming the SSE streams.
+const recentEvents = 64
+
+// WsClients is a mutex-protected set of all connected websocket (and SSE) clients.
 type WsClients struct {
 	sync.Mutex
-	clients map[*WsClient]int
+	clients map[subscriber]int
+	lastID  uint64  // Id of the last broadcast message.
+	recent  []event // Up to 'recentEvents' most recent messages.
 }
 
-// Adds a new websocket client to the set.
-func (m *WsClients) add(client *WsClient) {
+// Adds a new client to the set.
+func (m *WsClients) add(client subscriber) {
 	m.Lock()
 	defer m.Unlock()
 	m.clients[client] = len(m.clients) + 1
 	slog.Debug("client connected.", "client", m.clients[client])
 }
 
-// Removes existing websocket client from the set (e.g. on disconnect).
-func (m *WsClients) remove(client *WsClient) {
+// Adds a new client to the set, returns the new id for the current State sent
+// to it. When 'resume' is set, also returns the messages broadcast after
+// 'lastID', and whether all of them are still available.
+func (m *WsClients) subscribe(client subscriber, lastID uint64, resume bool) ([]event, uint64, bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.clients[client] = len(m.clients) + 1
+
+	var missed []event
+	resumed := resume && lastID <= m.lastID && (len(m.recent) == 0 || lastID+1 >= m.recent[0].id)
+	if resumed {
+		for _, e := range m.recent {
+			if e.id > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+	// The State is sent to this client only, so it isn't kept for resuming.
+	m.lastID++
+	return missed, m.lastID, resumed
+}
+
+// Returns the currently connected clients, in no particular order.
+func (m *WsClients) list() []ClientInfo {
+	m.Lock()
+	defer m.Unlock()
+	result := make([]ClientInfo, 0, len(m.clients))
+	for c, v := range m.clients {
+		info := c.info()
+		info.Id = v
+		result = append(result, info)
+	}
+	return result
+}
+
+// Removes existing client from the set (e.g. on disconnect).
+func (m *WsClients) remove(client subscriber) {
 	m.Lock()
 	defer m.Unlock()
 	slog.Debug("client disconnected.", "client", m.clients[client])
 	delete(m.clients, client)
 }
 
-// Sends the message to all currenly connected websocket clients.
+// Sends the message to all currenly connected clients, and keeps it for
+// resuming the SSE streams.
 func (m *WsClients) broadcast(msg string) {
 	m.Lock()
 	defer m.Unlock()
+
+	m.lastID++
+	m.recent = append(m.recent, event{m.lastID, msg})
+	if len(m.recent) > recentEvents {
+		m.recent = m.recent[1:]
+	}
+	m.send(m.lastID, msg)
+}
+
+// Sends the transient message (like a countdown) to all currently connected
+// clients. It has no id, so it isn't replayed to the resuming SSE streams.
+func (m *WsClients) broadcastTransient(msg string) {
+	m.Lock()
+	defer m.Unlock()
+	m.send(0, msg)
+}
+
+// Sends the message to all currently connected clients, removing the ones that
+// fail to receive it.
+// Assumes the mutex is locked and unlocked by the caller.
+func (m *WsClients) send(id uint64, msg string) {
 	for c, v := range m.clients {
 		slog.Debug("sending a message.", "client", v)
-		err := c.send(msg)
+		err := c.notify(id, msg)
 		if err != nil {
-			slog.Error("send failed, ignoring.", "client", v, "error", err)
+			// The client is unresponsive (e.g. a half-open connection of a sleeping laptop).
+			info := c.info()
+			slog.Info("send failed, removing the client.", "client", v, "remote", info.RemoteAddr, "error", err)
+			delete(m.clients, c)
+			c.close()
 		}
 	}
 }
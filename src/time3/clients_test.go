@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stand-in for a client, failing all the sends.
+type deadClient struct {
+	closed bool
+}
+
+func (c *deadClient) notify(uint64, string) error { return errors.New("argh") }
+func (c *deadClient) info() ClientInfo            { return ClientInfo{Kind: "test"} }
+func (c *deadClient) close()                      { c.closed = true }
+
+func Test_WsClients_broadcast_evicts(t *testing.T) {
+	client := &deadClient{}
+	clients.add(client)
+	defer clients.remove(client)
+
+	clients.broadcast(`{"event": "test"}`)
+	clients.Lock()
+	_, ok := clients.clients[client]
+	clients.Unlock()
+	if ok || !client.closed {
+		t.Errorf("clients.broadcast(), want: the client removed and closed, got: %v, %v", ok, client.closed)
+	}
+}
+
+// Connects to the websocket handler, and reads the current State.
+func dialWebsocket(t *testing.T, url string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial(), unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage(), unexpected error: %v", err)
+	}
+	return conn
+}
+
+func Test_websocketHandler_keepalive(t *testing.T) {
+	saved := *wsPingFlag
+	*wsPingFlag = 20 * time.Millisecond
+	defer func() { *wsPingFlag = saved }()
+
+	server := httptest.NewServer(http.HandlerFunc(websocketHandler))
+	t.Cleanup(server.Close)
+
+	// The client responds to the pings while it's reading.
+	alive := dialWebsocket(t, server.URL)
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitForClients(t, 1)
+	time.Sleep(10 * *wsPingFlag)
+	waitForClients(t, 1)
+
+	// This one doesn't read, so the pings are never answered.
+	dialWebsocket(t, server.URL)
+	waitForClients(t, 2)
+	waitForClients(t, 1)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -11,9 +13,7 @@ import (
 
 // Abstracts actual database operations.
 type Database struct {
-	db      *sql.DB
-	stopped chan struct{} // Receives an object when logger is stopped.
-	stop    chan struct{}
+	db *sql.DB
 }
 
 // Opens an existing database or creates a new one at the specified path.
@@ -23,9 +23,7 @@ func InitDB(path string) (*Database, error) {
 		return nil, err
 	}
 	return &Database{
-		db:      createTables(db),
-		stopped: make(chan struct{}),
-		stop:    make(chan struct{}),
+		db: createTables(db),
 	}, nil
 }
 
@@ -36,9 +34,7 @@ func newInMemoryDB() (*Database, error) {
 		return nil, err
 	}
 	return &Database{
-		db:      createTables(db),
-		stopped: make(chan struct{}),
-		stop:    make(chan struct{}),
+		db: createTables(db),
 	}, nil
 }
 
@@ -48,13 +44,87 @@ func createTables(db *sql.DB) *sql.DB {
 	slog.Info("Database version:", "version", version)
 
 	// Initialize necessary tables.
-	_, err := db.Exec(`create table if not exists days (
-		date text primary key,
-		work integer not null,
-		rest integer not null
-	);`)
-	if err != nil {
-		slog.Error("failed to create tables.", "err", err)
+	tables := []string{
+		`create table if not exists days (
+			date text primary key,
+			work integer not null,
+			rest integer not null
+		);`,
+		// Single-row table with the last persisted State snapshot.
+		`create table if not exists state (
+			id integer primary key check (id = 0),
+			snapshot text not null,
+			updated integer not null
+		);`,
+		// Append-only log of mode transitions and duration patches.
+		`create table if not exists transitions (
+			id integer primary key autoincrement,
+			time integer not null,
+			old_mode text not null,
+			new_mode text not null,
+			host text not null,
+			tag text not null default '',
+			work text not null default '',
+			rest text not null default ''
+		);`,
+		`create index if not exists transitions_time on transitions(time);`,
+		// API tokens, only the hashes of the tokens are stored.
+		`create table if not exists tokens (
+			hash text primary key,
+			name text unique not null,
+			scope text not null,
+			created integer not null
+		);`,
+		// Work time per tag for each day in the 'days' table.
+		`create table if not exists day_tags (
+			date text not null,
+			tag text not null,
+			work integer not null,
+			primary key (date, tag)
+		);`,
+		// Time per user-defined mode for each day in the 'days' table.
+		`create table if not exists day_modes (
+			date text not null,
+			mode text not null,
+			duration integer not null,
+			primary key (date, mode)
+		);`,
+		// Log of the webhook delivery attempts.
+		`create table if not exists deliveries (
+			id integer primary key autoincrement,
+			time integer not null,
+			url text not null,
+			event text not null,
+			attempt integer not null,
+			status integer not null,
+			error text not null default ''
+		);`,
+		// Log of the State mutations, with the remote hosts they came from.
+		`create table if not exists audit (
+			id integer primary key autoincrement,
+			time integer not null,
+			ip text not null,
+			user_agent text not null,
+			client text not null default '',
+			request text not null,
+			before text not null,
+			after text not null
+		);`,
+		`create index if not exists audit_time on audit(time);`,
+		// Remote hosts seen so far, and how many times each connected.
+		`create table if not exists hosts (
+			ip text not null,
+			user_agent text not null,
+			count integer not null,
+			first_seen integer not null,
+			last_seen integer not null,
+			primary key (ip, user_agent)
+		);`,
+	}
+	for _, table := range tables {
+		if _, err := db.Exec(table); err != nil {
+			slog.Error("failed to create tables.", "err", err)
+		}
 	}
 	return db
 }
@@ -64,55 +134,77 @@ func (db *Database) DaysCount() (count int) {
 	return
 }
 
-// Starts a logger goroutine that stored the day's data into the db at midnight.
-func (db *Database) StartLogger(state *State) {
-	go func() {
-		for {
-			now := time.Now()
-			dayEnd := time.Date(
-				now.Year(), now.Month(), now.Day(),
-				23, 59, 59, 1_000_000_000-1,
-				now.Location(),
-			)
-			slog.Info("next daily logger tick at:", "date", dayEnd, "day", formatDate(now))
-			var t *time.Ticker
-			if now.After(dayEnd) {
-				t = time.NewTicker(0 * time.Second) // tick immediately
-			} else {
-				t = time.NewTicker(dayEnd.Sub(now)) // tick at ~ 23:59:59
-			}
+// Updates the daily totals for the current day. Used without '-rollover', when
+// the totals accumulate across days.
+func (db *Database) StoreDailyTotals(state *State, now time.Time) error {
+	work, rest := state.getTotalDurations(now)
+	return db.storeDay(true, DayTotal{
+		Date:  formatDate(now),
+		Work:  work,
+		Rest:  rest,
+		Tags:  state.getTagTotals(now),
+		Modes: state.getModeTotals(now),
+	})
+}
 
-			select {
-			case <-t.C: // Tick: log the totals for the day.
-				if err := db.StoreDailyTotals(state, dayEnd); err != nil {
-					slog.Error("failed to update the daily total.", "err", err)
-				}
-				// Sleep for a while so the next day definitely starts.
-				time.Sleep(2 * time.Second)
-			case <-db.stop: // Request to stop the logger (server shutdown).
-				t.Stop()
-				defer func() {
-					db.stopped <- struct{}{}
-				}()
-				return
-			}
-		}
-	}()
+// Stores the day's totals, with its tags and modes. Nothing is stored for days
+// without any time logged.
+func (db *Database) StoreDay(day DayTotal) error {
+	return db.storeDay(false, day)
 }
 
-// Updates the daily totals for the current day.
-func (db *Database) StoreDailyTotals(state *State, now time.Time) error {
-	work, rest := state.getTotalDurations(now)
-	if work == 0 && rest == 0 {
+// Same as StoreDay(). With 'cumulative' totals, the day isn't stored if the
+// totals are the same as the ones of the previous stored day.
+func (db *Database) storeDay(cumulative bool, day DayTotal) error {
+	if day.isEmpty() {
 		return nil
 	}
-	return db.StoreValue(now, work, rest)
+	if err := db.storeDate(day.Date, day.Work, day.Rest, cumulative); err != nil {
+		return err
+	}
+	if err := db.StoreTags(day.Date, day.Tags); err != nil {
+		return err
+	}
+	return db.StoreModes(day.Date, day.Modes)
+}
+
+// Returns an error if the values can't be stored in the 'days' table.
+func validateDay(date string, work, rest time.Duration) error {
+	if !datePattern2.MatchString(date) {
+		return fmt.Errorf("Invalid date: '%s'.", date)
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return fmt.Errorf("Invalid date: '%s'.", date)
+	}
+	if work < 0 || rest < 0 {
+		return fmt.Errorf("Negative durations for %s: %v, %v.", date, work, rest)
+	}
+	return nil
 }
 
 func (db *Database) StoreValue(t time.Time, work, rest time.Duration) error {
-	date := formatDate(t)
+	return db.storeDate(formatDate(t), work, rest, true)
+}
+
+// Stores the totals for the date. With 'cumulative' totals (accumulated across
+// days, without '-rollover'), the totals that are the same as the ones of the
+// previous stored day are skipped, as nothing was done that day. The totals of
+// separate days can legitimately be the same, so they're always stored.
+func (db *Database) storeDate(date string, work, rest time.Duration, cumulative bool) error {
+	if err := validateDay(date, work, rest); err != nil {
+		return err
+	}
 	slog.Info("updating the daily total.", "date", date, "work", work, "rest", rest)
 
+	if !cumulative {
+		_, err := db.db.Exec(`insert or replace into days(date, work, rest) values (?, ?, ?)`,
+			date, work.Seconds(), rest.Seconds())
+		if err != nil {
+			slog.Error("storeDate() failed.", "err", err)
+		}
+		return err
+	}
+
 	stmt, err := db.db.Prepare(`
 		insert or replace into days(date, work, rest) select ?, ?, ?
 		where not exists (
@@ -128,36 +220,154 @@ func (db *Database) StoreValue(t time.Time, work, rest time.Duration) error {
 		date, work.Seconds(), rest.Seconds(),
 		date, work.Seconds(), rest.Seconds())
 	if err2 != nil {
-		slog.Error("StoreValue() failed.", "err", err2)
+		slog.Error("storeDate() failed.", "err", err2)
 	}
 	return err2
 }
 
-func (db *Database) ReadTotals(t1, t2 string) []string {
-	query := `select date, work, rest from days where date >= ? and date <= ? order by date desc`
-	rows, err := db.db.Query(query, t1, t2)
+// DayTotal is the total work and rest time logged for a single day.
+type DayTotal struct {
+	Date  string // In 'yyyy-mm-dd' format.
+	Work  time.Duration
+	Rest  time.Duration
+	Tags  map[string]time.Duration // Work time per tag, if any.
+	Modes map[string]time.Duration // Time per user-defined mode, if any.
+}
+
+// Returns 'true' if no time was logged for the day. The time in the modes
+// counting as neither work nor rest is logged too, see '-modes'.
+func (d DayTotal) isEmpty() bool {
+	if d.Work != 0 || d.Rest != 0 {
+		return false
+	}
+	for _, v := range d.Modes {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the fraction of work in the total logged time, or 0 if nothing was
+// logged. Not to be confused with the target work/rest ratio, see '-ratio'.
+func (d DayTotal) WorkShare() float64 {
+	if d.Work+d.Rest == 0 {
+		return 0
+	}
+	return d.Work.Seconds() / (d.Work + d.Rest).Seconds()
+}
+
+// Marshals the DayTotal with durations in seconds.
+func (d DayTotal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Date      string             `json:"date"`
+		Work      float64            `json:"work"`
+		Rest      float64            `json:"rest"`
+		WorkShare float64            `json:"workShare"`
+		Tags      map[string]float64 `json:"tags,omitempty"`
+		Modes     map[string]float64 `json:"modes,omitempty"`
+	}{d.Date, d.Work.Seconds(), d.Rest.Seconds(), d.WorkShare(), toSeconds(d.Tags), toSeconds(d.Modes)})
+}
+
+// Returns the totals for days between dates t1 and t2 (inclusive), in chronological order.
+func (db *Database) ReadDays(t1, t2 string) ([]DayTotal, error) {
+	return db.ReadBuckets(t1, t2, dayBucket)
+}
 
+// Returns the totals for days between dates t1 and t2 (inclusive) as strings
+// in 'yyyy-mm-dd work rest' format, most recent day first.
+func (db *Database) ReadTotals(t1, t2 string) []string {
+	days, err := db.ReadDays(t1, t2)
 	if err != nil {
 		slog.Info("error reading data.", "err", err)
+		metrics.dbError("read_days")
 		return []string{}
 	}
 
-	result := make([]string, 0)
-	for rows.Next() {
-		var date string
-		var work float64
-		var rest float64
-		if err := rows.Scan(&date, &work, &rest); err != nil {
-			return nil
-		}
-		result = append(result, fmt.Sprintf("%s %.2f %.2f", date, work, rest))
+	result := make([]string, 0, len(days))
+	for _, d := range slices.Backward(days) {
+		result = append(result, fmt.Sprintf("%s %.2f %.2f", d.Date, d.Work.Seconds(), d.Rest.Seconds()))
 	}
 	return result
 }
 
-// Stops logger goroutine and blocks until it exits.
-func (db *Database) StopLogger() {
-	db.stop <- struct{}{}
-	<-db.stopped
-	slog.Info("daily logger has stopped.")
+// Breakdown describes a table with per-day durations by some key (like a tag),
+// for the days stored in the 'days' table.
+type breakdown struct {
+	table string
+	key   string // Name of the key column.
+	value string // Name of the duration column, in seconds.
+}
+
+// Replaces the durations stored for the day, if the day itself is stored in
+// the 'days' table.
+func (db *Database) storeBreakdown(b breakdown, date string, durations map[string]time.Duration) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`select exists (select 1 from days where date = ?)`, date).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if err := b.replace(tx, date, durations); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the durations stored for the day within the transaction.
+func (b breakdown) replace(tx *sql.Tx, date string, durations map[string]time.Duration) error {
+	if _, err := tx.Exec(fmt.Sprintf(`delete from %s where date = ?`, b.table), date); err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`insert into %s(date, %s, %s) values (?, ?, ?)`, b.table, b.key, b.value)
+	for k, v := range durations {
+		if _, err := tx.Exec(query, date, k, v.Seconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fills in the durations for the days summed per bucket, using 'field' to get
+// the map to fill. Only the dates between t1 and t2 (inclusive) are summed.
+func (db *Database) readBreakdown(b breakdown, bucket *bucket, t1, t2 string,
+	days []DayTotal, field func(*DayTotal) *map[string]time.Duration) error {
+
+	if len(days) == 0 {
+		return nil
+	}
+	rows, err := db.db.Query(fmt.Sprintf(
+		`select %s as bucket, %s, sum(%s) from %s where date >= ? and date <= ? group by bucket, %s`,
+		bucket.sql, b.key, b.value, b.table, b.key), t1, t2)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[string]*DayTotal, len(days))
+	for i := range days {
+		index[days[i].Date] = &days[i]
+	}
+	for rows.Next() {
+		var date, key string
+		var seconds float64
+		if err := rows.Scan(&date, &key, &seconds); err != nil {
+			return err
+		}
+		if d, ok := index[date]; ok {
+			m := field(d)
+			if *m == nil {
+				*m = make(map[string]time.Duration)
+			}
+			(*m)[key] = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return rows.Err()
 }
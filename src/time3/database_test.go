@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"slices"
 	"testing"
 	"time"
@@ -45,6 +46,26 @@ func Test_StoreValue_IfDifferent(t *testing.T) {
 	}
 }
 
+func Test_ReadDays(t *testing.T) {
+	db := createDB(t)
+
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	db.StoreValue(now, 3*time.Hour, 1*time.Hour)
+	db.StoreValue(now.AddDate(0, 0, 1), 0, 0)
+
+	got, err := db.ReadDays("2025-05-28", "2025-06-01")
+	want := []DayTotal{
+		{Date: "2025-05-31", Work: 3 * time.Hour, Rest: 1 * time.Hour},
+		{Date: "2025-06-01", Work: 0, Rest: 0},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("db.ReadDays(), want: %v, got: %v, %v", want, got, err)
+	}
+	if got[0].WorkShare() != 0.75 || got[1].WorkShare() != 0 {
+		t.Errorf("DayTotal.WorkShare(), want: 0.75 and 0, got: %v and %v", got[0].WorkShare(), got[1].WorkShare())
+	}
+}
+
 func createDB(t *testing.T) *Database {
 	db, err := newInMemoryDB()
 	if err != nil {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // So that '-tz' works on systems without the time zone database.
+)
+
+// The time zone defining the day boundaries, see '-tz'.
+var timezone = time.Local
+
+// Sets the time zone by its IANA name, empty name stands for the local time zone.
+func setTimezone(name string) error {
+	if name == "" {
+		timezone = time.Local
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("Invalid time zone: '%s'.", name)
+	}
+	timezone = loc
+	return nil
+}
+
+// Time of the day at which each day starts, see '-day-start'.
+var dayOffset time.Duration
+
+// Sets the time at which days start, in 'HH:MM' format.
+func setDayStart(hhmm string) error {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return fmt.Errorf("Invalid day start: '%s'.", hhmm)
+	}
+	dayOffset = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return nil
+}
+
+// Returns the start of the day with the given date. The day starts at the same
+// wall clock time, regardless of the DST changes.
+func startOf(year int, month time.Month, day int) time.Time {
+	hours, minutes := int(dayOffset/time.Hour), int(dayOffset%time.Hour/time.Minute)
+	return time.Date(year, month, day, hours, minutes, 0, 0, timezone)
+}
+
+// Returns the date of the day 't' belongs to (in the configured time zone).
+// When days start later than midnight, times before the start of the day
+// belong to the previous day.
+func dateOf(t time.Time) (year int, month time.Month, day int) {
+	t = t.In(timezone)
+	year, month, day = t.Date()
+	if t.Before(startOf(year, month, day)) {
+		year, month, day = time.Date(year, month, day-1, 0, 0, 0, 0, time.UTC).Date()
+	}
+	return
+}
+
+// Formats the date of the day 'd' belongs to as 'yyyy-mm-dd'.
+func formatDate(d time.Time) string {
+	year, month, day := dateOf(d)
+	return fmt.Sprintf("%d-%02d-%02d", year, month, day)
+}
+
+// Parses the 'yyyy-mm-dd' date as the start of that day.
+func parseDate(date string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return startOf(t.Date()), nil
+}
+
+// Returns the start of the day 't' belongs to.
+func dayStart(t time.Time) time.Time {
+	return startOf(dateOf(t))
+}
+
+// Returns the start of the day following the one 't' belongs to. Days are not
+// always 24 hours long, because of the DST changes.
+func nextDayStart(t time.Time) time.Time {
+	year, month, day := dateOf(t)
+	return startOf(year, month, day+1)
+}
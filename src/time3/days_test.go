@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Sets the time zone for the duration of the test.
+func withTimezone(t *testing.T, name string) {
+	saved := timezone
+	t.Cleanup(func() { timezone = saved })
+	if err := setTimezone(name); err != nil {
+		t.Fatalf("setTimezone(), unexpected error: %v", err)
+	}
+}
+
+func Test_setTimezone_invalid(t *testing.T) {
+	withTimezone(t, "UTC")
+	if err := setTimezone("Mars/Olympus_Mons"); err == nil || timezone != time.UTC {
+		t.Errorf("setTimezone(), want: error and UTC kept, got: %v, %v", err, timezone)
+	}
+}
+
+func Test_formatDate_timezone(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T23:30:00Z")
+	if got := formatDate(now); got != "2025-06-01" {
+		t.Errorf("formatDate(), want: 2025-06-01, got: %s", got)
+	}
+
+	// The database stores the date in the configured time zone too.
+	db := createDB(t)
+	db.StoreValue(now, time.Hour, 0)
+	if days, _ := db.ReadDays("2025-06-01", "2025-06-01"); len(days) != 1 {
+		t.Errorf("db.ReadDays(), want: 1 day, got: %v", days)
+	}
+}
+
+func Test_nextDayStart_dst(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+	for _, tc := range []struct {
+		now    string
+		length time.Duration
+	}{
+		{"2025-03-30T10:00:00+02:00", 23 * time.Hour}, // Clocks go forward.
+		{"2025-10-26T10:00:00+01:00", 25 * time.Hour}, // Clocks go back.
+		{"2025-06-01T10:00:00+02:00", 24 * time.Hour},
+	} {
+		now, _ := time.Parse(time.RFC3339, tc.now)
+		start, next := dayStart(now), nextDayStart(now)
+		if length := next.Sub(start); length != tc.length {
+			t.Errorf("nextDayStart(%s), want: %v day, got: %v", tc.now, tc.length, length)
+		}
+		if formatDate(start) != tc.now[:10] || formatDate(next) == tc.now[:10] {
+			t.Errorf("dayStart(%s), want: day boundaries, got: %v, %v", tc.now, start, next)
+		}
+	}
+}
+
+func Test_newDailyChart_timezone(t *testing.T) {
+	withTimezone(t, "America/Los_Angeles")
+	db := createDB(t)
+	db.ImportDays([]DayTotal{{Date: "2025-11-02", Work: time.Hour}}, true)
+
+	// The DST change on 2025-11-02 doesn't skip or repeat any days.
+	opts, _ := newOptions("2025-11-03", 3, 400, 300)
+	c := newDailyChart(db, opts)
+	if want := []string{"11-01", "11-02", "11-03"}; !reflect.DeepEqual(c.labels, want) {
+		t.Errorf("newDailyChart().labels, want: %v, got: %v", want, c.labels)
+	}
+	if c.values[1][0] != 1 {
+		t.Errorf("newDailyChart().values, want: 1h of work on 11-02, got: %v", c.values)
+	}
+}
+
+func Test_parseTime_timezone(t *testing.T) {
+	withTimezone(t, "Asia/Tokyo")
+	got, _ := parseTime("2025-06-01", false)
+	if want, _ := time.Parse(time.RFC3339, "2025-06-01T00:00:00+09:00"); !got.Equal(want) {
+		t.Errorf("parseTime(), want: %v, got: %v", want, got)
+	}
+}
+
+// Sets the day start for the duration of the test.
+func withDayStart(t *testing.T, hhmm string) {
+	saved := dayOffset
+	t.Cleanup(func() { dayOffset = saved })
+	if err := setDayStart(hhmm); err != nil {
+		t.Fatalf("setDayStart(), unexpected error: %v", err)
+	}
+}
+
+func Test_setDayStart_invalid(t *testing.T) {
+	withDayStart(t, "00:00")
+	for _, hhmm := range []string{"", "4", "24:00", "04:60", "argh"} {
+		if err := setDayStart(hhmm); err == nil {
+			t.Errorf("setDayStart(%s), want: error, got: nil", hhmm)
+		}
+	}
+}
+
+func Test_formatDate_dayStart(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+	withDayStart(t, "04:00")
+
+	// A session from 22:00 to 02:00 belongs to a single day.
+	for _, s := range []string{"2025-05-31T22:00:00+02:00", "2025-06-01T02:00:00+02:00", "2025-06-01T03:59:59+02:00"} {
+		now, _ := time.Parse(time.RFC3339, s)
+		if got := formatDate(now); got != "2025-05-31" {
+			t.Errorf("formatDate(%s), want: 2025-05-31, got: %s", s, got)
+		}
+	}
+	now, _ := time.Parse(time.RFC3339, "2025-06-01T04:00:00+02:00")
+	if got := formatDate(now); got != "2025-06-01" {
+		t.Errorf("formatDate(%v), want: 2025-06-01, got: %s", now, got)
+	}
+}
+
+func Test_nextDayStart_dayStart(t *testing.T) {
+	withTimezone(t, "Europe/Berlin")
+	withDayStart(t, "04:30")
+
+	// The clocks go forward at 2am, but the day still starts at 04:30.
+	now, _ := time.Parse(time.RFC3339, "2025-03-30T01:00:00+01:00")
+	start, next := dayStart(now), nextDayStart(now)
+	wantStart, _ := time.Parse(time.RFC3339, "2025-03-29T04:30:00+01:00")
+	wantNext, _ := time.Parse(time.RFC3339, "2025-03-30T04:30:00+02:00")
+	if !start.Equal(wantStart) || !next.Equal(wantNext) {
+		t.Errorf("dayStart(), nextDayStart(), want: %v, %v, got: %v, %v", wantStart, wantNext, start, next)
+	}
+
+	// The end of the day in the history APIs is right before the next day starts.
+	end, _ := parseTime("2025-03-29", true)
+	if want := wantNext.Add(-time.Millisecond); !end.Equal(want) {
+		t.Errorf("parseTime(), want: %v, got: %v", want, end)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Range of dates covering all the days in the database.
+const (
+	firstDate = "0000-01-01"
+	lastDate  = "9999-12-31"
+)
+
+// Unmarshals the DayTotal from the format produced by MarshalJSON, 'workShare' is ignored.
+func (d *DayTotal) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Date  string             `json:"date"`
+		Work  float64            `json:"work"`
+		Rest  float64            `json:"rest"`
+		Tags  map[string]float64 `json:"tags"`
+		Modes map[string]float64 `json:"modes"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	d.Date = v.Date
+	d.Work = time.Duration(v.Work * float64(time.Second))
+	d.Rest = time.Duration(v.Rest * float64(time.Second))
+	d.Tags = fromSeconds(v.Tags)
+	d.Modes = fromSeconds(v.Modes)
+	return nil
+}
+
+// Stores the days (with their tags and modes) in the 'days' table in a single transaction.
+// Existing days are replaced if 'overwrite' is set, and kept intact otherwise.
+// Returns the number of days actually stored.
+func (db *Database) ImportDays(days []DayTotal, overwrite bool) (int, error) {
+	for _, d := range days {
+		if err := validateDay(d.Date, d.Work, d.Rest); err != nil {
+			return 0, err
+		}
+	}
+
+	query := `insert or ignore into days(date, work, rest) values (?, ?, ?)`
+	if overwrite {
+		query = `insert or replace into days(date, work, rest) values (?, ?, ?)`
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for _, d := range days {
+		result, err := tx.Exec(query, d.Date, d.Work.Seconds(), d.Rest.Seconds())
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		count += int(n)
+		if n == 0 {
+			continue // Existing day was kept.
+		}
+		if err := tagBreakdown.replace(tx, d.Date, d.Tags); err != nil {
+			return 0, err
+		}
+		if err := modeBreakdown.replace(tx, d.Date, d.Modes); err != nil {
+			return 0, err
+		}
+	}
+	return count, tx.Commit()
+}
+
+// Writes the days as CSV with 'date,work,rest' columns, durations in seconds.
+func writeDaysCsv(w io.Writer, days []DayTotal) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"date", "work", "rest"})
+	for _, d := range days {
+		writer.Write([]string{
+			d.Date,
+			strconv.FormatFloat(d.Work.Seconds(), 'f', -1, 64),
+			strconv.FormatFloat(d.Rest.Seconds(), 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Reads the days from CSV produced by writeDaysCsv. The header line is optional.
+func readDaysCsv(r io.Reader) ([]DayTotal, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && records[0][0] == "date" {
+		records = records[1:]
+	}
+
+	result := make([]DayTotal, 0, len(records))
+	for _, record := range records {
+		work, err1 := strconv.ParseFloat(record[1], 64)
+		rest, err2 := strconv.ParseFloat(record[2], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("Invalid durations for %s: '%s', '%s'.", record[0], record[1], record[2])
+		}
+		result = append(result, DayTotal{
+			Date: record[0],
+			Work: time.Duration(work * float64(time.Second)),
+			Rest: time.Duration(rest * float64(time.Second)),
+		})
+	}
+	return result, nil
+}
+
+// Reads the days in the given format, either 'csv' or 'json'.
+func readDays(r io.Reader, format string) ([]DayTotal, error) {
+	switch format {
+	case "csv":
+		return readDaysCsv(r)
+	case "json":
+		var result []DayTotal
+		if err := json.NewDecoder(r).Decode(&result); err != nil {
+			return nil, fmt.Errorf("Error while unmarshalling: %v", err)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("Invalid format: '%s'.", format)
+}
+
+// Responds with all the days in the database, the request has to specify:
+//   - 'format', optional, either 'json' (default) or 'csv'
+func exportHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, fmt.Sprintf("Invalid format: '%s'.", format), http.StatusBadRequest)
+			return
+		}
+
+		days, err := db.ReadDays(firstDate, lastDate)
+		if err != nil {
+			slog.Error("failed to read days.", "err", err)
+			metrics.dbError("read_days")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "csv" {
+			var buffer bytes.Buffer
+			if err := writeDaysCsv(&buffer, days); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="time3-days.csv"`)
+			w.Write(buffer.Bytes())
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="time3-days.json"`)
+		writeJson(w, days)
+	}
+}
+
+// Imports days from the HTTP POST request body, the request has to specify:
+//   - 'format', optional, either 'json' (default) or 'csv'
+//   - 'mode', optional, either 'skip' (default) to keep existing days, or 'overwrite'
+//
+// Responds with JSON object with the number of imported days.
+func importHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+
+		params := r.URL.Query()
+		format := params.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		overwrite, err := parseImportMode(params.Get("mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer r.Body.Close()
+		days, err := readDays(r.Body, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		count, err := db.ImportDays(days, overwrite)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Info("imported days.", "count", count, "total", len(days), "overwrite", overwrite)
+		writeJson(w, map[string]int{"imported": count, "total": len(days)})
+	}
+}
+
+// Returns 'true' for the 'overwrite' import mode, and 'false' for 'skip'.
+func parseImportMode(mode string) (bool, error) {
+	switch mode {
+	case "", "skip":
+		return false, nil
+	case "overwrite":
+		return true, nil
+	}
+	return false, fmt.Errorf("Invalid import mode: '%s'.", mode)
+}
+
+// Imports days from a '.csv' or '.json' file into the database.
+func importFile(db *Database, path string, mode string) error {
+	overwrite, err := parseImportMode(mode)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format := "json"
+	if filepath.Ext(path) == ".csv" {
+		format = "csv"
+	}
+	days, err := readDays(file, format)
+	if err != nil {
+		return err
+	}
+
+	count, err := db.ImportDays(days, overwrite)
+	if err != nil {
+		return err
+	}
+	slog.Info("imported days.", "file", path, "count", count, "total", len(days), "overwrite", overwrite)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ImportDays(t *testing.T) {
+	db := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	db.StoreValue(now, 1*time.Hour, 1*time.Hour)
+
+	days := []DayTotal{
+		{Date: "2025-05-31", Work: 2 * time.Hour, Rest: 0},
+		{Date: "2025-06-01", Work: 3 * time.Hour, Rest: 0},
+	}
+
+	// Existing 2025-05-31 is kept.
+	count, err := db.ImportDays(days, false)
+	if count != 1 || err != nil {
+		t.Errorf("db.ImportDays(), want: 1, nil, got: %d, %v", count, err)
+	}
+	want := []string{"2025-06-01 10800.00 0.00", "2025-05-31 3600.00 3600.00"}
+	if got := db.ReadTotals(firstDate, lastDate); !slices.Equal(got, want) {
+		t.Errorf("db.ReadTotals(), want: %v, got: %v", want, got)
+	}
+
+	// Existing 2025-05-31 is replaced.
+	count, err = db.ImportDays(days, true)
+	if count != 2 || err != nil {
+		t.Errorf("db.ImportDays(), want: 2, nil, got: %d, %v", count, err)
+	}
+	want = []string{"2025-06-01 10800.00 0.00", "2025-05-31 7200.00 0.00"}
+	if got := db.ReadTotals(firstDate, lastDate); !slices.Equal(got, want) {
+		t.Errorf("db.ReadTotals(), want: %v, got: %v", want, got)
+	}
+}
+
+func Test_ImportDays_invalid(t *testing.T) {
+	db := createDB(t)
+
+	for _, days := range [][]DayTotal{
+		{{Date: "2025-06-01", Work: time.Hour}, {Date: "2025-13-01"}},
+		{{Date: "yesterday"}},
+		{{Date: "2025-06-01", Work: -time.Hour}},
+	} {
+		if _, err := db.ImportDays(days, true); err == nil {
+			t.Errorf("db.ImportDays(%v), want: error, got: nil", days)
+		}
+	}
+	// Nothing is imported when any of the days is invalid.
+	if got := db.DaysCount(); got != 0 {
+		t.Errorf("db.DaysCount(), want: 0, got: %d", got)
+	}
+}
+
+func Test_exportImport_roundTrip(t *testing.T) {
+	src := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	src.StoreValue(now, 12345*time.Millisecond, 67890*time.Millisecond)
+	src.StoreValue(now.AddDate(0, 0, 1), 2*time.Hour, 30*time.Minute)
+
+	for _, format := range []string{"csv", "json"} {
+		w := httptest.NewRecorder()
+		exportHandler(src)(w, httptest.NewRequest("GET", "/api/export?format="+format, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("exportHandler(%s), want: 200, got: %d", format, w.Code)
+		}
+
+		dst := createDB(t)
+		w2 := httptest.NewRecorder()
+		importHandler(dst)(w2, httptest.NewRequest(
+			"POST", "/api/import?mode=overwrite&format="+format, bytes.NewReader(w.Body.Bytes())))
+
+		want := `{"imported":2,"total":2}`
+		if got := strings.TrimSpace(w2.Body.String()); got != want {
+			t.Errorf("importHandler(%s), want: %s, got: %s", format, want, got)
+		}
+		wantRows := src.ReadTotals(firstDate, lastDate)
+		if got := dst.ReadTotals(firstDate, lastDate); !slices.Equal(got, wantRows) {
+			t.Errorf("round trip (%s), want: %v, got: %v", format, wantRows, got)
+		}
+	}
+}
+
+func Test_writeDaysCsv(t *testing.T) {
+	var buffer bytes.Buffer
+	writeDaysCsv(&buffer, []DayTotal{{Date: "2025-05-31", Work: 1500 * time.Millisecond, Rest: time.Hour}})
+
+	want := "date,work,rest\n2025-05-31,1.5,3600\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("writeDaysCsv(), want: %q, got: %q", want, got)
+	}
+}
+
+func Test_importFile(t *testing.T) {
+	db := createDB(t)
+	path := filepath.Join(t.TempDir(), "days.csv")
+	os.WriteFile(path, []byte("2025-05-31,3600,60\n"), 0o644)
+
+	if err := importFile(db, path, "skip"); err != nil {
+		t.Fatalf("importFile(), unexpected error: %v", err)
+	}
+	want := []string{"2025-05-31 3600.00 60.00"}
+	if got := db.ReadTotals(firstDate, lastDate); !slices.Equal(got, want) {
+		t.Errorf("db.ReadTotals(), want: %v, got: %v", want, got)
+	}
+
+	if err := importFile(db, path, "merge"); err == nil {
+		t.Errorf("importFile(), want: error for invalid mode, got: nil")
+	}
+}
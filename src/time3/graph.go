@@ -23,6 +23,8 @@ type options struct {
 	days   int
 	width  int
 	height int
+	split  string  // Optional breakdown in the graph, "tags", "modes" or empty.
+	bucket *bucket // Days aggregated into each bar.
 }
 
 var datePattern2 = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
@@ -32,23 +34,37 @@ func newOptions(date string, days, width, height int) (*options, error) {
 	if !datePattern2.MatchString(date) {
 		return nil, fmt.Errorf("Invalid date: '%s'.", date)
 	}
-	if days < 1 || days > 31 {
+	if days < 1 || days > maxDays {
 		return nil, fmt.Errorf("Invalid days: '%d'.", days)
 	}
 	if width < 200 || width > 2000 {
 		return nil, fmt.Errorf("Invalid width: '%d'.", width)
 	}
 	if height < 100 || height > 1000 {
-		return nil, fmt.Errorf("Invalid width: '%d'.", height)
+		return nil, fmt.Errorf("Invalid height: '%d'.", height)
 	}
 	return &options{
 		date:   date,
 		days:   days,
 		width:  width,
 		height: height,
+		bucket: autoBucket(days),
 	}, nil
 }
 
+// Returns the number of days between the dates 'from' and 'to' (inclusive).
+func daysBetween(from, to string) (int, error) {
+	t1, err := time.Parse(time.DateOnly, from)
+	if !datePattern2.MatchString(from) || err != nil {
+		return 0, fmt.Errorf("Invalid from: '%s'.", from)
+	}
+	t2, err := time.Parse(time.DateOnly, to)
+	if !datePattern2.MatchString(to) || err != nil {
+		return 0, fmt.Errorf("Invalid to: '%s'.", to)
+	}
+	return int(t2.Sub(t1).Hours()/24) + 1, nil
+}
+
 func graphPageHandler(db *Database) func(a http.ResponseWriter, b *http.Request) {
 	dummyImage, _ := f2.ReadFile("dummy_graph.png")
 	scriptTemplate, _ := f2.ReadFile("daily_totals_template.gnuplot")
@@ -68,15 +84,17 @@ func graphPageHandler(db *Database) func(a http.ResponseWriter, b *http.Request)
 			return
 		}
 
-		if scriptTemplate == nil {
-			http.Error(w, "Gnuplot script not found.", http.StatusInternalServerError)
-		}
-
 		// The request has to specify:
-		//   - 'date', the latest date to plot
+		//   - 'date' (or 'to'), the latest date to plot
 		//   - 'n', optional number of historical days to plot, defaults to 7
+		//   - 'from', optional first date to plot, instead of 'n'
+		//   - 'bucket', optional aggregation of the days into bars, 'day',
+		//     'week' (ISO), 'month' or 'auto' (default, depends on the range)
 		//   - 'w', optional width of the image in pixels, defaults to 1200
 		//   - 'h', optional height of the image in pixels, defaults to 600
+		//   - 'f', optional image format, 'png' (default) or 'svg'
+		//   - 'split', optional breakdown of work per tag ('tags'), or of work
+		//     and rest per user-defined mode ('modes')
 
 		params := r.URL.Query()
 		if len(params) == 0 {
@@ -84,42 +102,121 @@ func graphPageHandler(db *Database) func(a http.ResponseWriter, b *http.Request)
 			return
 		}
 
+		date := params.Get("date")
+		if to := params.Get("to"); to != "" {
+			date = to
+		}
+		days := parseInt(params.Get("n"), 7)
+		if from := params.Get("from"); from != "" {
+			var err error
+			if days, err = daysBetween(from, date); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		opts, err := newOptions(
-			params.Get("date"),
-			parseInt(params.Get("n"), 7),
+			date,
+			days,
 			parseInt(params.Get("w"), 1200),
 			parseInt(params.Get("h"), 600),
 		)
+		if err == nil {
+			opts.bucket, err = parseBucket(params.Get("bucket"), days)
+		}
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		opts.split = params.Get("split")
+		if !slices.Contains([]string{"", "tags", "modes"}, opts.split) {
+			http.Error(w, fmt.Sprintf("Invalid split: '%s'.", opts.split), http.StatusBadRequest)
+			return
+		}
 		slog.Info("querying the database.", "opts", opts)
 
-		w.Header().Set("Content-Type", "image/png")
-		png, err2 := plotGraph(db, opts, string(scriptTemplate))
-		if err2 != nil {
-			// No gnuplot available - just respond with the dummy (empty) graph image.
-			if _, err := w.Write(dummyImage); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		format := params.Get("f")
+		var data []byte
+		switch format {
+		case "", "png":
+			// The gnuplot script only plots the daily totals.
+			if *gnuplotFlag && scriptTemplate != nil && opts.split == "" && opts.bucket == dayBucket {
+				data, err = plotGraph(db, opts, string(scriptTemplate))
+				if err != nil {
+					slog.Info("gnuplot failed, using the built-in renderer.", "err", err)
+				}
 			}
-		} else {
-			if _, err := w.Write(png); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			if data == nil {
+				data, err = newDailyChart(db, opts).png()
 			}
+			w.Header().Set("Content-Type", "image/png")
+		case "svg":
+			data = newDailyChart(db, opts).svg()
+			w.Header().Set("Content-Type", "image/svg+xml")
+		default:
+			http.Error(w, fmt.Sprintf("Invalid format: '%s'.", format), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
 }
 
-func formatDate(d time.Time) string {
-	return fmt.Sprintf("%d-%02d-%02d", d.Year(), d.Month(), d.Day())
+// Returns the first and the last day to plot.
+func (opts *options) dateRange() (t1, t2 time.Time) {
+	t2, _ = parseDate(opts.date)
+	t1 = t2.AddDate(0, 0, -opts.days+1)
+	return
+}
+
+// Constructs the stacked work/rest chart with one bar per day (or per week or
+// month), optionally split by tags or by modes.
+func newDailyChart(db *Database, opts *options) *chart {
+	t1, t2 := opts.dateRange()
+
+	days, err := db.ReadBuckets(formatDate(t1), opts.date, opts.bucket)
+	if err != nil {
+		slog.Info("error reading data.", "err", err)
+		metrics.dbError("read_days")
+	}
+	totals := make(map[string]DayTotal)
+	for _, d := range days {
+		totals[d.Date] = d
+	}
+
+	result := chart{
+		width:  opts.width,
+		height: opts.height,
+		yLabel: "hours",
+	}
+	var values func(DayTotal) []float64
+	switch opts.split {
+	case "modes":
+		result.series, values = splitByModes(days)
+	case "tags":
+		result.series, values = splitByTags(days)
+	default:
+		result.series, values = splitByTags(nil)
+	}
+
+	for d := opts.bucket.start(t1); !d.After(t2); d = opts.bucket.next(d) {
+		date := formatDate(d)
+		result.labels = append(result.labels, opts.bucket.label(date))
+		result.values = append(result.values, values(totals[date]))
+	}
+	return &result
 }
 
 // Execs 'gnuplot' with data, returns the resulting png image.
 func plotGraph(db *Database, opts *options, script string) ([]byte, error) {
-	t2, _ := time.Parse(time.RFC3339, opts.date+"T00:00:01Z")
-	t1 := t2.AddDate(0, 0, -opts.days+1)
+	t1, t2 := opts.dateRange()
 
 	data := db.ReadTotals(formatDate(t1), opts.date)
 	hasPrefix := func(p string) func(s string) bool {
@@ -142,8 +239,11 @@ func plotGraph(db *Database, opts *options, script string) ([]byte, error) {
 	scriptStr := script
 	scriptStr = strings.ReplaceAll(scriptStr, "%WIDTH%", fmt.Sprintf("%d", opts.width))
 	scriptStr = strings.ReplaceAll(scriptStr, "%HEIGHT%", fmt.Sprintf("%d", opts.height))
-	scriptStr = strings.ReplaceAll(scriptStr, "%XMIN%", fmt.Sprintf("%d", t1.UnixMilli()/1000-42200))
-	scriptStr = strings.ReplaceAll(scriptStr, "%XMAX%", fmt.Sprintf("%d", t2.UnixMilli()/1000+42200))
+	// Gnuplot parses the dates in the data as UTC.
+	xmin, _ := time.Parse(time.DateOnly, formatDate(t1))
+	xmax, _ := time.Parse(time.DateOnly, formatDate(t2))
+	scriptStr = strings.ReplaceAll(scriptStr, "%XMIN%", fmt.Sprintf("%d", xmin.Unix()-42200))
+	scriptStr = strings.ReplaceAll(scriptStr, "%XMAX%", fmt.Sprintf("%d", xmax.Unix()+42200))
 
 	cmd := exec.Command("gnuplot")
 
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Maximum number of the recent mode changes and duration patches that can be undone.
+const historySize = 20
+
+// History keeps the States around the recent mode changes and duration
+// patches, so that they can be undone and redone.
+type History struct {
+	undo []*StateSnapshot // States before the recent changes, the most recent last.
+	redo []*StateSnapshot // States before the recent undos, the most recent last.
+}
+
+// Remembers the State before a change, the changes undone so far can't be
+// redone anymore.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) remember(before *StateSnapshot) {
+	h := &state.history
+	h.undo = append(h.undo, before)
+	if len(h.undo) > historySize {
+		h.undo = h.undo[1:]
+	}
+	h.redo = nil
+}
+
+// Undoes or redoes the most recent change, depending on the command. Returns
+// the resulting Transition, and 'false' if there was nothing to undo or redo.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) undoRedoLocked(command string) (*Transition, bool, error) {
+	from, to := &state.history.undo, &state.history.redo
+	switch command {
+	case "undo":
+	case "redo":
+		from, to = to, from
+	default:
+		return nil, false, fmt.Errorf("Invalid command: '%s'.", command)
+	}
+	if len(*from) == 0 {
+		slog.Info("nothing to " + command + ", ignoring.")
+		return nil, false, nil
+	}
+
+	target := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+	*to = append(*to, state.toSnapshot())
+
+	// Like manual mode changes, undo takes over from the schedule.
+	state.stopSchedule()
+	return state.revertTo(target), true, nil
+}
+
+// Overwrites the State with the snapshot, keeping the current ratio. Returns
+// the resulting Transition, with the differences in work and rest as patches.
+// The Transition is at the restored mode start, as the time since then counts
+// towards the restored mode (the Transitions after it are replaced, see
+// ReadIntervals()).
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) revertTo(snapshot *StateSnapshot) *Transition {
+	now := clock.Now()
+	oldMode := state.mode.toString()
+	work, rest := state.totals(now)
+
+	mode := modeFromString(snapshot.Mode)
+	if mode == nil {
+		// The snapshots are taken from the State itself, so this shouldn't happen.
+		mode = &state.mode
+	}
+	ratio := state.ratio
+	state.fromSnapshot(snapshot, *mode)
+	state.ratio = ratio
+
+	newWork, newRest := state.totals(now)
+	return &Transition{Time: state.modeStart, From: oldMode, To: state.mode.toString(), Tag: state.tag,
+		Work: negated(work - newWork), Rest: negated(rest - newRest)}
+}
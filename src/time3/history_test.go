@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_State_undoRedo_changeMode(t *testing.T) {
+	saved := mockClock.now
+	defer func() { mockClock.now = saved }()
+	state := State{mode: Work, modeStart: clock.Now(), work: time.Hour}
+
+	mockClock.now = mockClock.now.Add(10 * time.Minute)
+	state.changeModeAtLocked("rest", "", time.Time{})
+	mockClock.now = mockClock.now.Add(5 * time.Minute)
+
+	// Undo attributes the time since the mode change to the previous mode, so
+	// the Transition is at the time the previous mode started.
+	transition, ok, err := state.undoRedoLocked("undo")
+	if err != nil || !ok {
+		t.Fatalf("state.undoRedoLocked(), unexpected result: %v, %v", ok, err)
+	}
+	want := State{mode: Work, modeStart: saved, work: time.Hour}
+	if !sameState(&state, &want) {
+		t.Errorf("state.undoRedoLocked(), want: %s, got: %s", &want, &state)
+	}
+	wantTransition := Transition{Time: saved, From: "rest", To: "work", Work: "5m0s", Rest: "-5m0s"}
+	if *transition != wantTransition {
+		t.Errorf("state.undoRedoLocked(), want: %v, got: %v", wantTransition, transition)
+	}
+
+	// Redo brings back the State as it was before the undo.
+	if _, ok, _ := state.undoRedoLocked("redo"); !ok || state.mode != Rest || state.work != 70*time.Minute {
+		t.Errorf("state.undoRedoLocked(), want: rest after 1h10m of work, got: %s", &state)
+	}
+	if _, ok, _ := state.undoRedoLocked("redo"); ok {
+		t.Errorf("state.undoRedoLocked(), want: nothing to redo, got: %s", &state)
+	}
+}
+
+func Test_State_undoRedo_patchDurations(t *testing.T) {
+	state := State{mode: Off, modeStart: clock.Now(), work: time.Hour}
+	state.patchDurationsLocked("-30m", "+10m")
+
+	if transition, ok, _ := state.undoRedoLocked("undo"); !ok || state.work != time.Hour || state.rest != 0 {
+		t.Errorf("state.undoRedoLocked(), want: the patch undone, got: %s", &state)
+	} else if transition.Work != "30m0s" || transition.Rest != "-10m0s" {
+		t.Errorf("state.undoRedoLocked(), want: 30m0s, -10m0s, got: %v", transition)
+	}
+
+	// A new change can't be followed by redo.
+	state.undoRedoLocked("redo")
+	state.undoRedoLocked("undo")
+	state.patchDurationsLocked("+1m", "")
+	if _, ok, _ := state.undoRedoLocked("redo"); ok {
+		t.Errorf("state.undoRedoLocked(), want: nothing to redo after a change, got: %s", &state)
+	}
+}
+
+func Test_State_remember_bounded(t *testing.T) {
+	state := State{mode: Off, modeStart: clock.Now()}
+	for range historySize + 5 {
+		state.patchDurationsLocked("+1m", "")
+	}
+	undone := 0
+	for {
+		if _, ok, _ := state.undoRedoLocked("undo"); !ok {
+			break
+		}
+		undone++
+	}
+	if undone != historySize || state.work != 5*time.Minute {
+		t.Errorf("state.undoRedoLocked(), want: %d undos down to 5m0s, got: %d, %s", historySize, undone, &state)
+	}
+}
+
+func Test_handleJsonRequest_command(t *testing.T) {
+	saved := state.snapshot()
+	defer state.restore(saved)
+	state.restore(&StateSnapshot{Mode: "work", ModeStart: clock.Now()})
+
+	if err := handleJsonRequest(&JsonRequest{Command: "argh"}, HostInfo{}); err == nil {
+		t.Errorf("handleJsonRequest(), want: error for an invalid command, got: nil")
+	}
+	if err := handleJsonRequest(&JsonRequest{Command: "undo", Ago: "5m"}, HostInfo{}); err == nil {
+		t.Errorf("handleJsonRequest(), want: error for a backdated undo, got: nil")
+	}
+	if err := handleJsonRequest(&JsonRequest{Command: "undo"}, HostInfo{}); err != nil || state.mode != Work {
+		t.Errorf("handleJsonRequest(), want: nothing to undo, got: %v, %s", err, &state)
+	}
+
+	handleJsonRequest(&JsonRequest{Mode: "rest"}, HostInfo{})
+	if err := handleJsonRequest(&JsonRequest{Command: "undo"}, HostInfo{}); err != nil || state.mode != Work {
+		t.Errorf("handleJsonRequest(), want: work after undo, got: %v, %s", err, &state)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// HostSeen is when a remote host connected for the first and the last time.
+type HostSeen struct {
+	First time.Time
+	Last  time.Time
+}
+
+// HostRecord is a remote host, as stored in the database.
+type HostRecord struct {
+	Host  HostInfo
+	Count uint64
+	Seen  HostSeen
+}
+
+// HostEntry is a remote host, as listed on the admin page.
+type HostEntry struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Count     uint64    `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Returns all the hosts seen so far, in no particular order.
+func (hosts *RemoteHosts) entries() []HostEntry {
+	hosts.Lock()
+	defer hosts.Unlock()
+	result := make([]HostEntry, 0, len(hosts.set))
+	for key, count := range hosts.set {
+		seen := hosts.seen[key]
+		result = append(result, HostEntry{IP: key.ip, UserAgent: key.userAgent, Count: count,
+			FirstSeen: seen.First, LastSeen: seen.Last})
+	}
+	return result
+}
+
+// Stores the host with its connection count, replacing the previous record.
+func (db *Database) StoreHost(h *HostRecord) error {
+	_, err := db.db.Exec(`
+		insert into hosts(ip, user_agent, count, first_seen, last_seen) values (?, ?, ?, ?, ?)
+		on conflict(ip, user_agent) do update set
+			count = excluded.count, first_seen = excluded.first_seen, last_seen = excluded.last_seen`,
+		h.Host.ip, h.Host.userAgent, h.Count, h.Seen.First.UnixMilli(), h.Seen.Last.UnixMilli())
+	return err
+}
+
+// Returns all the stored hosts.
+func (db *Database) ReadHosts() ([]HostRecord, error) {
+	rows, err := db.db.Query(`select ip, user_agent, count, first_seen, last_seen from hosts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]HostRecord, 0)
+	for rows.Next() {
+		var h HostRecord
+		var first, last int64
+		if err := rows.Scan(&h.Host.ip, &h.Host.userAgent, &h.Count, &first, &last); err != nil {
+			return nil, err
+		}
+		h.Seen = HostSeen{First: time.UnixMilli(first), Last: time.UnixMilli(last)}
+		result = append(result, h)
+	}
+	return result, rows.Err()
+}
+
+// Starts persisting the hosts to the database, after loading the hosts stored
+// there. The hosts seen so far are merged with the stored ones.
+func (hosts *RemoteHosts) load(db *Database) error {
+	hosts.Lock()
+	defer hosts.Unlock()
+	records, err := db.ReadHosts()
+	if err != nil {
+		return err
+	}
+	hosts.db = db
+	if hosts.set == nil {
+		hosts.set = make(map[HostInfo]uint64)
+	}
+	if hosts.seen == nil {
+		hosts.seen = make(map[HostInfo]HostSeen)
+	}
+	for _, r := range records {
+		hosts.set[r.Host] += r.Count
+		seen, ok := hosts.seen[r.Host]
+		if !ok || r.Seen.First.Before(seen.First) {
+			seen.First = r.Seen.First
+		}
+		if r.Seen.Last.After(seen.Last) {
+			seen.Last = r.Seen.Last
+		}
+		hosts.seen[r.Host] = seen
+	}
+	// The hosts seen so far (marked dirty by add()) are stored with the merged counts.
+	hosts.flushLocked()
+	return nil
+}
+
+// Marks the host to be stored on the next flush().
+// Assumes the mutex is locked and unlocked by the caller.
+func (hosts *RemoteHosts) markDirty(key HostInfo) {
+	if hosts.dirty == nil {
+		hosts.dirty = make(map[HostInfo]bool)
+	}
+	hosts.dirty[key] = true
+}
+
+// Stores the hosts changed since the last flush, if the database is set. The
+// writes are batched (see the hourly log()), rather than done on every request.
+func (hosts *RemoteHosts) flush() {
+	hosts.Lock()
+	defer hosts.Unlock()
+	hosts.flushLocked()
+}
+
+// Same as flush(). The hosts failed to store are retried on the next flush.
+// Assumes the mutex is locked and unlocked by the caller.
+func (hosts *RemoteHosts) flushLocked() {
+	if hosts.db == nil {
+		return
+	}
+	for key := range hosts.dirty {
+		record := HostRecord{Host: key, Count: hosts.set[key], Seen: hosts.seen[key]}
+		if err := hosts.db.StoreHost(&record); err != nil {
+			slog.Error("failed to store the remote host.", "host", &key, "err", err)
+			metrics.dbError("store_host")
+			continue
+		}
+		delete(hosts.dirty, key)
+	}
+}
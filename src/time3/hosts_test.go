@@ -60,3 +60,47 @@ func Test_Hosts_concurrent(t *testing.T) {
 		t.Errorf("hosts.asTable(), want:\n[%s]\n, got:\n[%s]\n", expected2, got)
 	}
 }
+
+func Test_Hosts_persisted(t *testing.T) {
+	saved := mockClock.now
+	defer func() { mockClock.now = saved }()
+	db := createDB(t)
+
+	// Hosts seen before the database is loaded are stored as well.
+	hosts := RemoteHosts{}
+	host1 := HostInfo{ip: "ip1", userAgent: "agent1"}
+	hosts.add(host1)
+	if err := hosts.load(db); err != nil {
+		t.Fatalf("hosts.load(), unexpected error: %v", err)
+	}
+	mockClock.now = mockClock.now.Add(time.Hour)
+	hosts.add(host1)
+	hosts.add(HostInfo{ip: "ip2", userAgent: "agent2"})
+
+	// The hosts are only stored on flush.
+	if stored, _ := db.ReadHosts(); len(stored) != 1 || stored[0].Count != 1 {
+		t.Errorf("db.ReadHosts(), want: 1 host before the flush, got: %v", stored)
+	}
+	hosts.flush()
+
+	// E.g. after a restart.
+	restarted := RemoteHosts{}
+	if err := restarted.load(db); err != nil {
+		t.Fatalf("hosts.load(), unexpected error: %v", err)
+	}
+	if restarted.add(host1) {
+		t.Errorf("hosts.add(), want: a known host, got: a new one")
+	}
+	want := HostSeen{First: saved, Last: mockClock.now}
+	if restarted.set[host1] != 3 || restarted.seen[host1] != want {
+		t.Errorf("hosts.load(), want: 3 connections, %v, got: %d, %v", want, restarted.set[host1], restarted.seen[host1])
+	}
+
+	// The hosts failed to store are kept for the next flush.
+	db.db.Close()
+	restarted.flush()
+	if !restarted.dirty[host1] || restarted.set[host1] != 3 {
+		t.Errorf("hosts.flush(), want: %v still dirty with 3 connections, got: %v, %v",
+			host1, restarted.dirty, restarted.set)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the request latency histogram buckets, in seconds.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts the observed values in 'latencyBuckets'.
+type histogram struct {
+	counts []uint64 // Not cumulative, counts[i] is for values in (bucket[i-1], bucket[i]].
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(latencyBuckets, v); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// Metrics is a mutex-protected set of counters exposed on '/metrics'.
+type Metrics struct {
+	sync.Mutex
+	modeChanges map[[2]string]uint64  // Number of mode changes per (from, to) modes.
+	latencies   map[string]*histogram // Request latencies per handler.
+	dbErrors    map[string]uint64     // Number of failed database operations per operation.
+}
+
+var metrics = Metrics{
+	modeChanges: make(map[[2]string]uint64),
+	latencies:   make(map[string]*histogram),
+	dbErrors:    make(map[string]uint64),
+}
+
+// Counts the transition, if it changes the mode.
+func (m *Metrics) modeChanged(t *Transition) {
+	if t.From == t.To {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.modeChanges[[2]string{t.From, t.To}]++
+}
+
+// Counts the failed database operation.
+func (m *Metrics) dbError(operation string) {
+	m.Lock()
+	defer m.Unlock()
+	m.dbErrors[operation]++
+}
+
+// Records the latency of a request to the handler.
+func (m *Metrics) observeLatency(handler string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	h := m.latencies[handler]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[handler] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// Wraps the handler to record the request latencies under the given name.
+func instrument(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler(w, r)
+		metrics.observeLatency(name, time.Since(start))
+	}
+}
+
+// Escapes the label value for the Prometheus text format.
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) write(w io.Writer) {
+	work, rest := state.getTotalDurations(clock.Now())
+	state.Lock()
+	mode := state.mode
+	state.Unlock()
+
+	fmt.Fprintln(w, "# HELP time3_mode Current mode, 1 for the current one and 0 for the others.")
+	fmt.Fprintln(w, "# TYPE time3_mode gauge")
+	for i, info := range modeRegistry {
+		value := 0
+		if ModeType(i) == mode {
+			value = 1
+		}
+		fmt.Fprintf(w, "time3_mode{mode=\"%s\"} %d\n", labelValue(info.Name), value)
+	}
+
+	fmt.Fprintln(w, "# HELP time3_today_work_seconds Work time of the current day.")
+	fmt.Fprintln(w, "# TYPE time3_today_work_seconds gauge")
+	fmt.Fprintf(w, "time3_today_work_seconds %.3f\n", work.Seconds())
+	fmt.Fprintln(w, "# HELP time3_today_rest_seconds Rest time of the current day.")
+	fmt.Fprintln(w, "# TYPE time3_today_rest_seconds gauge")
+	fmt.Fprintf(w, "time3_today_rest_seconds %.3f\n", rest.Seconds())
+
+	var websockets, streams int
+	clients.Lock()
+	for c := range clients.clients {
+		if _, ok := c.(*SseClient); ok {
+			streams++
+		} else {
+			websockets++
+		}
+	}
+	clients.Unlock()
+	fmt.Fprintln(w, "# HELP time3_websocket_clients Number of connected websocket clients.")
+	fmt.Fprintln(w, "# TYPE time3_websocket_clients gauge")
+	fmt.Fprintf(w, "time3_websocket_clients %d\n", websockets)
+	fmt.Fprintln(w, "# HELP time3_sse_clients Number of connected Server-Sent Events clients.")
+	fmt.Fprintln(w, "# TYPE time3_sse_clients gauge")
+	fmt.Fprintf(w, "time3_sse_clients %d\n", streams)
+
+	remoteHosts.Lock()
+	hosts := len(remoteHosts.set)
+	remoteHosts.Unlock()
+	fmt.Fprintln(w, "# HELP time3_remote_hosts Number of distinct remote hosts seen.")
+	fmt.Fprintln(w, "# TYPE time3_remote_hosts gauge")
+	fmt.Fprintf(w, "time3_remote_hosts %d\n", hosts)
+
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintln(w, "# HELP time3_mode_changes_total Number of mode changes.")
+	fmt.Fprintln(w, "# TYPE time3_mode_changes_total counter")
+	for _, k := range slices.SortedFunc(maps.Keys(m.modeChanges), func(a, b [2]string) int {
+		return strings.Compare(a[0]+"\n"+a[1], b[0]+"\n"+b[1])
+	}) {
+		fmt.Fprintf(w, "time3_mode_changes_total{from=\"%s\",to=\"%s\"} %d\n",
+			labelValue(k[0]), labelValue(k[1]), m.modeChanges[k])
+	}
+
+	fmt.Fprintln(w, "# HELP time3_http_request_duration_seconds Latency of the HTTP requests per handler.")
+	fmt.Fprintln(w, "# TYPE time3_http_request_duration_seconds histogram")
+	for _, name := range slices.Sorted(maps.Keys(m.latencies)) {
+		h := m.latencies[name]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "time3_http_request_duration_seconds_bucket{handler=\"%s\",le=\"%g\"} %d\n",
+				labelValue(name), le, cumulative)
+		}
+		fmt.Fprintf(w, "time3_http_request_duration_seconds_bucket{handler=\"%s\",le=\"+Inf\"} %d\n",
+			labelValue(name), h.count)
+		fmt.Fprintf(w, "time3_http_request_duration_seconds_sum{handler=\"%s\"} %g\n", labelValue(name), h.sum)
+		fmt.Fprintf(w, "time3_http_request_duration_seconds_count{handler=\"%s\"} %d\n", labelValue(name), h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP time3_database_errors_total Number of failed database operations.")
+	fmt.Fprintln(w, "# TYPE time3_database_errors_total counter")
+	for _, op := range slices.Sorted(maps.Keys(m.dbErrors)) {
+		fmt.Fprintf(w, "time3_database_errors_total{operation=\"%s\"} %d\n", labelValue(op), m.dbErrors[op])
+	}
+}
+
+// Writes the metrics in the Prometheus text format to the response.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.write(w)
+}
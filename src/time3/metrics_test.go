@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		modeChanges: make(map[[2]string]uint64),
+		latencies:   make(map[string]*histogram),
+		dbErrors:    make(map[string]uint64),
+	}
+}
+
+func Test_Metrics_write(t *testing.T) {
+	saved := state.snapshot()
+	defer state.restore(saved)
+	state.restore(&StateSnapshot{Work: time.Hour, Rest: time.Minute, Mode: "rest", ModeStart: clock.Now()})
+
+	m := newMetrics()
+	m.modeChanged(&Transition{From: "work", To: "rest"})
+	m.modeChanged(&Transition{From: "work", To: "rest"})
+	m.modeChanged(&Transition{From: "rest", To: "rest"}) // Duration patch.
+	m.dbError("read_days")
+	m.observeLatency("graph", 30*time.Millisecond)
+	m.observeLatency("graph", 20*time.Second)
+
+	var b strings.Builder
+	m.write(&b)
+	got := b.String()
+	for _, want := range []string{
+		`time3_mode{mode="work"} 0`,
+		`time3_mode{mode="rest"} 1`,
+		`time3_today_work_seconds 3600.000`,
+		`time3_today_rest_seconds 60.000`,
+		`time3_mode_changes_total{from="work",to="rest"} 2`,
+		`time3_database_errors_total{operation="read_days"} 1`,
+		`time3_http_request_duration_seconds_bucket{handler="graph",le="0.025"} 0`,
+		`time3_http_request_duration_seconds_bucket{handler="graph",le="0.05"} 1`,
+		`time3_http_request_duration_seconds_bucket{handler="graph",le="10"} 1`,
+		`time3_http_request_duration_seconds_bucket{handler="graph",le="+Inf"} 2`,
+		`time3_http_request_duration_seconds_count{handler="graph"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics.write(), want: %s, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `from="rest",to="rest"`) {
+		t.Errorf("metrics.write(), want: no duration patches, got:\n%s", got)
+	}
+}
+
+func Test_labelValue(t *testing.T) {
+	if got := labelValue("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("labelValue(), want: %s, got: %s", `a\"b\\c\nd`, got)
+	}
+}
+
+func Test_instrument(t *testing.T) {
+	t.Cleanup(func() {
+		metrics.Lock()
+		defer metrics.Unlock()
+		delete(metrics.latencies, "test")
+	})
+	handler := instrument("test", func(w http.ResponseWriter, r *http.Request) {})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	if h := metrics.latencies["test"]; h == nil || h.count != 1 {
+		t.Errorf("instrument(), want: 1 request, got: %v", h)
+	}
+}
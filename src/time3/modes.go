@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Category is an enum representing what the time spent in a mode counts as.
+type Category int
+
+const (
+	CountsNone Category = iota // Neither work nor rest, like 'off'.
+	CountsWork
+	CountsRest
+)
+
+// Returns a string representation of a given Category.
+func (c Category) toString() string {
+	if c < 0 || c > 2 {
+		return "unknown"
+	}
+	return []string{"none", "work", "rest"}[c]
+}
+
+// Returns a *Category for a given string, or nil for invalid strings.
+func categoryFromString(str string) *Category {
+	var result Category
+	switch str {
+	case "none":
+		result = CountsNone
+	case "work":
+		result = CountsWork
+	case "rest":
+		result = CountsRest
+	default:
+		return nil
+	}
+	return &result
+}
+
+// ModeInfo describes a mode in the registry.
+type ModeInfo struct {
+	Name   string
+	Counts Category
+	Color  string // In '#rrggbb' format.
+}
+
+// The registry of all known modes, indexed by ModeType. The built-in modes
+// always come first, user-defined modes (see '-modes') are appended after them.
+var modeRegistry = []ModeInfo{
+	{Name: "work", Counts: CountsWork, Color: hexColor(workColor)},
+	{Name: "rest", Counts: CountsRest, Color: hexColor(restColor)},
+	{Name: "off", Counts: CountsNone, Color: "#909995"},
+}
+
+var (
+	modeNamePattern  = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+	modeColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// Returns the registry entry for the mode, or nil for invalid modes.
+func (m ModeType) info() *ModeInfo {
+	if m < 0 || int(m) >= len(modeRegistry) {
+		return nil
+	}
+	return &modeRegistry[m]
+}
+
+// Returns what the time spent in the mode counts as.
+func (m ModeType) counts() Category {
+	if info := m.info(); info != nil {
+		return info.Counts
+	}
+	return CountsNone
+}
+
+// Returns 'true' for user-defined modes.
+func (m ModeType) isCustom() bool {
+	return m > Off && m.info() != nil
+}
+
+// Returns the registry entry for the mode name. Modes which are not (or no
+// longer) registered count as neither work nor rest.
+func modeInfo(name string) ModeInfo {
+	if m := modeFromString(name); m != nil {
+		return *m.info()
+	}
+	return ModeInfo{Name: name, Counts: CountsNone, Color: modeRegistry[Off].Color}
+}
+
+// Appends the modes to the registry, after validating them.
+func registerModes(modes []ModeInfo) error {
+	for _, mode := range modes {
+		if !modeNamePattern.MatchString(mode.Name) {
+			return fmt.Errorf("Invalid mode name: '%s'.", mode.Name)
+		}
+		if modeFromString(mode.Name) != nil {
+			return fmt.Errorf("Duplicate mode: '%s'.", mode.Name)
+		}
+		if !modeColorPattern.MatchString(mode.Color) {
+			return fmt.Errorf("Invalid color for mode '%s': '%s'.", mode.Name, mode.Color)
+		}
+		modeRegistry = append(modeRegistry, mode)
+	}
+	return nil
+}
+
+// Reads user-defined modes from a JSON file and adds them to the registry. The
+// file contains a list like: [{"name": "meeting", "counts": "work", "color": "#5f3dc4"}].
+func loadModes(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var list []struct {
+		Name   string `json:"name"`
+		Counts string `json:"counts"`
+		Color  string `json:"color"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("Error while unmarshalling %s: %v", path, err)
+	}
+
+	var modes []ModeInfo
+	for _, v := range list {
+		counts := categoryFromString(v.Counts)
+		if counts == nil {
+			return fmt.Errorf("Invalid category for mode '%s': '%s'.", v.Name, v.Counts)
+		}
+		modes = append(modes, ModeInfo{Name: v.Name, Counts: *counts, Color: v.Color})
+	}
+	return registerModes(modes)
+}
+
+// Adds the duration to the current mode's total, if it's a user-defined mode.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) addModeTime(duration time.Duration) {
+	if !state.mode.isCustom() {
+		return
+	}
+	if state.modeTotals == nil {
+		state.modeTotals = make(map[string]time.Duration)
+	}
+	state.modeTotals[state.mode.toString()] += duration
+}
+
+// Resets the per-mode totals once both work and rest are reset to zero.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) patchModeTotals() {
+	if state.work == 0 && state.rest == 0 {
+		state.modeTotals = nil
+	}
+}
+
+// Returns the total duration per user-defined mode, including the current session.
+func (state *State) getModeTotals(cutoff time.Time) map[string]time.Duration {
+	state.Lock()
+	defer state.Unlock()
+
+	from, stale := state.intervalStart(cutoff)
+	var result map[string]time.Duration
+	if !stale {
+		result = maps.Clone(state.modeTotals)
+	}
+	if duration := cutoff.Sub(from); state.mode.isCustom() && duration > 0 {
+		if result == nil {
+			result = make(map[string]time.Duration)
+		}
+		result[state.mode.toString()] += duration
+	}
+	return result
+}
+
+// Per-day durations for each user-defined mode, stored in the 'day_modes' table.
+var modeBreakdown = breakdown{table: "day_modes", key: "mode", value: "duration"}
+
+// Replaces the per-mode durations stored for the day, if the day itself is
+// stored in the 'days' table.
+func (db *Database) StoreModes(date string, modes map[string]time.Duration) error {
+	return db.storeBreakdown(modeBreakdown, date, modes)
+}
+
+// Returns the chart series and per-day values with work and rest split by the
+// user-defined modes. Modes counting as neither are stacked on top.
+func splitByModes(days []DayTotal) ([]series, func(DayTotal) []float64) {
+	var names []string
+	for _, d := range days {
+		for name := range d.Modes {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	// Registry order, with unregistered modes last.
+	index := func(name string) int {
+		if m := modeFromString(name); m != nil {
+			return int(*m)
+		}
+		return len(modeRegistry)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if v := index(a) - index(b); v != 0 {
+			return v
+		}
+		return strings.Compare(a, b)
+	})
+
+	var result []series
+	var order []string // Empty string stands for the rest of work or rest.
+	var categories []Category
+	for _, c := range []Category{CountsWork, CountsRest, CountsNone} {
+		switch c {
+		case CountsWork:
+			result = append(result, series{"work", workColor})
+		case CountsRest:
+			result = append(result, series{"rest", restColor})
+		}
+		if c != CountsNone {
+			order = append(order, "")
+			categories = append(categories, c)
+		}
+		for _, name := range names {
+			if info := modeInfo(name); info.Counts == c {
+				result = append(result, series{name, parseColor(info.Color)})
+				order = append(order, name)
+				categories = append(categories, c)
+			}
+		}
+	}
+
+	return result, func(total DayTotal) []float64 {
+		remaining := map[Category]time.Duration{CountsWork: total.Work, CountsRest: total.Rest}
+		for name, d := range total.Modes {
+			remaining[modeInfo(name).Counts] -= d
+		}
+		var values []float64
+		for i, name := range order {
+			if name == "" {
+				values = append(values, max(remaining[categories[i]], 0).Hours())
+			} else {
+				values = append(values, total.Modes[name].Hours())
+			}
+		}
+		return values
+	}
+}
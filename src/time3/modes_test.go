@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Registers the modes for the duration of the test.
+func withModes(t *testing.T, modes ...ModeInfo) {
+	saved := modeRegistry
+	t.Cleanup(func() { modeRegistry = saved })
+	modeRegistry = append([]ModeInfo(nil), modeRegistry...)
+	if err := registerModes(modes); err != nil {
+		t.Fatalf("registerModes(), unexpected error: %v", err)
+	}
+}
+
+var (
+	meetingMode = ModeInfo{Name: "meeting", Counts: CountsWork, Color: "#5f3dc4"}
+	breakMode   = ModeInfo{Name: "break", Counts: CountsNone, Color: "#d9480f"}
+)
+
+func Test_registerModes(t *testing.T) {
+	withModes(t, meetingMode)
+
+	if m := modeFromString("meeting"); m == nil || *m != 3 || m.toString() != "meeting" {
+		t.Errorf(`modeFromString("meeting"), want: (ModeType = 3), got: %v`, m)
+	}
+	if !ModeType(3).isCustom() || Off.isCustom() || ModeType(4).isCustom() {
+		t.Errorf("isCustom(), want: only true for 'meeting'")
+	}
+}
+
+func Test_registerModes_invalid(t *testing.T) {
+	withModes(t)
+
+	for _, mode := range []ModeInfo{
+		{Name: "work", Color: "#000000"},
+		{Name: "Deep work", Color: "#000000"},
+		{Name: "", Color: "#000000"},
+		{Name: "admin", Color: "blue"},
+	} {
+		if err := registerModes([]ModeInfo{mode}); err == nil {
+			t.Errorf("registerModes(%v), want: error, got: nil", mode)
+		}
+	}
+}
+
+func Test_loadModes(t *testing.T) {
+	withModes(t)
+	path := filepath.Join(t.TempDir(), "modes.json")
+
+	os.WriteFile(path, []byte(`[{"name": "admin", "counts": "argh", "color": "#000000"}]`), 0o644)
+	if err := loadModes(path); err == nil {
+		t.Errorf("loadModes(), want: error for invalid category, got: nil")
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "break", "counts": "none", "color": "#d9480f"}]`), 0o644)
+	if err := loadModes(path); err != nil {
+		t.Fatalf("loadModes(), unexpected error: %v", err)
+	}
+	if got := modeInfo("break"); got != breakMode {
+		t.Errorf(`modeInfo("break"), want: %v, got: %v`, breakMode, got)
+	}
+}
+
+func Test_State_customModes(t *testing.T) {
+	withModes(t, meetingMode, breakMode)
+	state := State{mode: Work, modeStart: clock.Now()}
+
+	mockClock.now = mockClock.now.Add(10 * time.Second)
+	state.changeModeAtLocked("meeting", "", time.Time{})
+	mockClock.now = mockClock.now.Add(20 * time.Second)
+	state.changeModeAtLocked("break", "", time.Time{})
+	mockClock.now = mockClock.now.Add(30 * time.Second)
+
+	// The meeting counts as work, the break counts as neither.
+	work, rest := state.getTotalDurations(clock.Now())
+	if work != 30*time.Second || rest != 0 {
+		t.Errorf("getTotalDurations(), want: 30s, 0s, got: %v, %v", work, rest)
+	}
+	want := map[string]time.Duration{"meeting": 20 * time.Second, "break": 30 * time.Second}
+	if got := state.getModeTotals(clock.Now()); !reflect.DeepEqual(got, want) {
+		t.Errorf("getModeTotals(), want: %v, got: %v", want, got)
+	}
+
+	// Resetting both work and rest resets the modes too.
+	state.patchDurationsLocked("-1h", "-1h")
+	if state.modeTotals != nil {
+		t.Errorf("state.patchDurationsLocked(), want: no mode totals, got: %v", state.modeTotals)
+	}
+}
+
+func Test_StoreModes(t *testing.T) {
+	db := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+	db.StoreValue(now, 2*time.Hour, 0)
+	db.StoreModes("2025-05-31", map[string]time.Duration{"meeting": time.Hour})
+
+	days, _ := db.ReadDays("2025-05-31", "2025-05-31")
+	want := []DayTotal{{Date: "2025-05-31", Work: 2 * time.Hour, Modes: map[string]time.Duration{"meeting": time.Hour}}}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("db.ReadDays(), want: %v, got: %v", want, days)
+	}
+}
+
+func Test_newDailyChart_modes(t *testing.T) {
+	withModes(t, meetingMode, breakMode)
+	db := createDB(t)
+	db.ImportDays([]DayTotal{{
+		Date:  "2025-05-31",
+		Work:  3 * time.Hour,
+		Rest:  time.Hour,
+		Modes: map[string]time.Duration{"meeting": time.Hour, "break": 30 * time.Minute},
+	}}, true)
+
+	opts, _ := newOptions("2025-05-31", 1, 400, 300)
+	opts.split = "modes"
+	c := newDailyChart(db, opts)
+
+	var names []string
+	for _, s := range c.series {
+		names = append(names, s.name)
+	}
+	if want := []string{"work", "meeting", "rest", "break"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("newDailyChart().series, want: %v, got: %v", want, names)
+	}
+	if want := [][]float64{{2, 1, 1, 0.5}}; !reflect.DeepEqual(c.values, want) {
+		t.Errorf("newDailyChart().values, want: %v, got: %v", want, c.values)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// StateSnapshot is a serializable copy of the State, used for persisting it
+// across server restarts.
+type StateSnapshot struct {
+	Work      time.Duration            `json:"work"`
+	Rest      time.Duration            `json:"rest"`
+	Mode      string                   `json:"mode"`
+	ModeStart time.Time                `json:"modeStart"`
+	Tag       string                   `json:"tag,omitempty"`
+	Tags      map[string]time.Duration `json:"tags,omitempty"`
+	Modes     map[string]time.Duration `json:"modes,omitempty"`
+	Ratio     float64                  `json:"ratio,omitempty"`
+}
+
+// StateStore persists State snapshots somewhere durable.
+type StateStore interface {
+	// Stores the snapshot, replacing the previously stored one.
+	SaveState(snapshot *StateSnapshot) error
+	// Returns the last stored snapshot, or nil if nothing was stored yet.
+	LoadState() (*StateSnapshot, error)
+}
+
+// Returns a snapshot of the State.
+func (state *State) snapshot() *StateSnapshot {
+	state.Lock()
+	defer state.Unlock()
+	return state.toSnapshot()
+}
+
+// Returns a snapshot of the State.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) toSnapshot() *StateSnapshot {
+	return &StateSnapshot{
+		Work:      state.work,
+		Rest:      state.rest,
+		Mode:      state.mode.toString(),
+		ModeStart: state.modeStart,
+		Tag:       state.tag,
+		Tags:      maps.Clone(state.tags),
+		Modes:     maps.Clone(state.modeTotals),
+		Ratio:     state.ratio,
+	}
+}
+
+// Overwrites the State with values from the snapshot. An unknown mode is replaced
+// with 'off', starting at the same time. A ratio missing from the
+// snapshot keeps the current one (set by '-ratio'). On startup, an explicitly
+// set '-ratio' is applied after the restore, overriding the snapshot's ratio.
+func (state *State) restore(snapshot *StateSnapshot) error {
+	mode := modeFromString(snapshot.Mode)
+	if mode == nil {
+		// E.g. a user-defined mode removed from '-modes' since the snapshot was taken.
+		slog.Warn("unknown mode in snapshot, falling back to 'off'.", "mode", snapshot.Mode)
+		off := Off
+		mode = &off
+	}
+	if snapshot.Work < 0 || snapshot.Rest < 0 {
+		return fmt.Errorf("Negative durations in snapshot: %v, %v.", snapshot.Work, snapshot.Rest)
+	}
+	if !validRatio(snapshot.Ratio) {
+		return fmt.Errorf("Invalid ratio in snapshot: %v.", snapshot.Ratio)
+	}
+
+	state.Lock()
+	defer state.Unlock()
+	state.fromSnapshot(snapshot, *mode)
+	// The restored State doesn't follow from the remembered changes.
+	state.history = History{}
+	return nil
+}
+
+// Overwrites the State with values from the (valid) snapshot.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) fromSnapshot(snapshot *StateSnapshot, mode ModeType) {
+	state.work = snapshot.Work
+	state.rest = snapshot.Rest
+	state.mode = mode
+	state.modeStart = snapshot.ModeStart
+	state.tag = snapshot.Tag
+	state.tags = maps.Clone(snapshot.Tags)
+	state.modeTotals = maps.Clone(snapshot.Modes)
+	if snapshot.Ratio > 0 {
+		state.ratio = snapshot.Ratio
+	}
+}
+
+// StateFile is a StateStore keeping the snapshot in a standalone JSON file.
+type StateFile struct {
+	path string
+}
+
+// Writes the snapshot to a temporary file first, and then atomically renames it,
+// so that a crash never leaves a half-written state file behind.
+func (file *StateFile) SaveState(snapshot *StateSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp := file.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file.path)
+}
+
+func (file *StateFile) LoadState() (*StateSnapshot, error) {
+	data, err := os.ReadFile(file.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result StateSnapshot
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling %s: %v", file.path, err)
+	}
+	return &result, nil
+}
+
+// Stores the snapshot in the single-row 'state' table.
+func (db *Database) SaveState(snapshot *StateSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec(
+		`insert or replace into state(id, snapshot, updated) values (0, ?, ?)`,
+		string(data), clock.Now().UnixMilli())
+	return err
+}
+
+func (db *Database) LoadState() (*StateSnapshot, error) {
+	var data string
+	err := db.db.QueryRow(`select snapshot from state where id = 0`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result StateSnapshot
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling state: %v", err)
+	}
+	return &result, nil
+}
+
+// The store used for persisting the global State, nil when persistence is disabled.
+var stateStore StateStore
+
+// Serializes concurrent saves, so an older snapshot never overwrites a newer one.
+var stateStoreMutex sync.Mutex
+
+// Persists the current global State, if persistence is enabled.
+func saveState() {
+	if stateStore == nil {
+		return
+	}
+	stateStoreMutex.Lock()
+	defer stateStoreMutex.Unlock()
+
+	if err := stateStore.SaveState(state.snapshot()); err != nil {
+		slog.Error("failed to persist the state.", "err", err)
+		metrics.dbError("save_state")
+	}
+}
+
+// Restores the global State from the store, if there's anything stored.
+func loadState(store StateStore) error {
+	snapshot, err := store.LoadState()
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		slog.Info("no persisted state found, starting fresh.")
+		return nil
+	}
+	if err := state.restore(snapshot); err != nil {
+		return err
+	}
+	slog.Info("restored persisted state.", "state", &state)
+	return nil
+}
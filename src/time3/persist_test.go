@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_StateFile_roundTrip(t *testing.T) {
+	file := StateFile{path: filepath.Join(t.TempDir(), "state.json")}
+	assertRoundTrip(&file, t)
+}
+
+func Test_StateFile_missing(t *testing.T) {
+	file := StateFile{path: filepath.Join(t.TempDir(), "missing.json")}
+	got, err := file.LoadState()
+	if got != nil || err != nil {
+		t.Errorf("file.LoadState(), want: nil, nil, got: %v, %v", got, err)
+	}
+}
+
+func Test_StateFile_corrupted(t *testing.T) {
+	file := StateFile{path: filepath.Join(t.TempDir(), "state.json")}
+	os.WriteFile(file.path, []byte("{garbage"), 0o644)
+
+	if _, err := file.LoadState(); err == nil {
+		t.Errorf("file.LoadState(), want: error, got: nil")
+	}
+}
+
+func Test_Database_stateRoundTrip(t *testing.T) {
+	db := createDB(t)
+
+	got, err := db.LoadState()
+	if got != nil || err != nil {
+		t.Errorf("db.LoadState(), want: nil, nil, got: %v, %v", got, err)
+	}
+
+	assertRoundTrip(db, t)
+}
+
+func Test_State_snapshotRestore(t *testing.T) {
+	state := State{
+		work:      10 * time.Second,
+		rest:      20 * time.Second,
+		mode:      Rest,
+		modeStart: clock.Now(),
+	}
+
+	var restored State
+	if err := restored.restore(state.snapshot()); err != nil {
+		t.Fatalf("restored.restore(), unexpected error: %v", err)
+	}
+	if !sameState(&restored, &state) {
+		t.Errorf("restored.restore(), want: %s, got: %s", &state, &restored)
+	}
+}
+
+func Test_State_restore_invalid(t *testing.T) {
+	var state State
+	if err := state.restore(&StateSnapshot{Mode: "work", Work: -1}); err == nil {
+		t.Errorf("state.restore(), want: error for negative work, got: nil")
+	}
+}
+
+func Test_State_restore_unknownMode(t *testing.T) {
+	// E.g. a user-defined mode removed from '-modes'.
+	start := clock.Now().Add(-time.Hour)
+	var state State
+	if err := state.restore(&StateSnapshot{Mode: "argh", ModeStart: start, Work: time.Minute}); err != nil {
+		t.Fatalf("state.restore(), unexpected error: %v", err)
+	}
+	want := State{mode: Off, modeStart: start, work: time.Minute}
+	if !sameState(&state, &want) {
+		t.Errorf("state.restore(), want: %s, got: %s", &want, &state)
+	}
+}
+
+func assertRoundTrip(store StateStore, t *testing.T) {
+	// Round-trip through JSON loses the monotonic clock reading, so strip it.
+	want := StateSnapshot{
+		Work:      12_345 * time.Millisecond,
+		Rest:      67_890 * time.Millisecond,
+		Mode:      "work",
+		ModeStart: clock.Now().Round(0),
+	}
+	if err := store.SaveState(&want); err != nil {
+		t.Fatalf("store.SaveState(), unexpected error: %v", err)
+	}
+
+	// The second save replaces the first one.
+	want.Mode = "rest"
+	if err := store.SaveState(&want); err != nil {
+		t.Fatalf("store.SaveState(), unexpected error: %v", err)
+	}
+
+	got, err := store.LoadState()
+	if err != nil {
+		t.Fatalf("store.LoadState(), unexpected error: %v", err)
+	}
+	if !got.ModeStart.Equal(want.ModeStart) ||
+		got.Work != want.Work || got.Rest != want.Rest || got.Mode != want.Mode {
+		t.Errorf("store.LoadState(), want: %+v, got: %+v", want, *got)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Maximum target work/rest ratio, anything above is effectively "no rest".
+const maxRatio = 100
+
+// Returns 'true' if the ratio is valid, 0 being a valid "disabled" ratio.
+func validRatio(ratio float64) bool {
+	return ratio >= 0 && ratio <= maxRatio
+}
+
+// Sets the ratio from '-ratio', before the state is restored or changed. Also
+// after the restore, when '-ratio' is set explicitly.
+func (state *State) initRatio(ratio float64) error {
+	if !validRatio(ratio) {
+		return fmt.Errorf("Invalid ratio: %v.", ratio)
+	}
+	state.Lock()
+	defer state.Unlock()
+
+	state.ratio = ratio
+	return nil
+}
+
+// Changes the target work/rest ratio. Returns 'true' if it was changed.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) setRatioLocked(ratio float64) bool {
+	if ratio <= 0 || !validRatio(ratio) {
+		slog.Info("invalid ratio specified, ignoring.", "ratio", ratio)
+		return false
+	}
+	if state.ratio == ratio {
+		return false
+	}
+	state.ratio = ratio
+	return true
+}
+
+// Returns the balance of earned rest at the cutoff: the work divided by the
+// ratio, minus the rest already taken. Negative when too much rest was taken.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) earnedRest(cutoff time.Time) time.Duration {
+	if state.ratio <= 0 {
+		return 0
+	}
+	work, rest := state.totals(cutoff)
+	return time.Duration(float64(work)/state.ratio) - rest
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func Test_State_earnedRest(t *testing.T) {
+	state := State{
+		work:      90 * time.Minute,
+		rest:      10 * time.Minute,
+		mode:      Work,
+		modeStart: clock.Now(),
+		ratio:     3,
+	}
+
+	mockClock.now = mockClock.now.Add(30 * time.Minute)
+	if got := state.earnedRest(clock.Now()); got != 30*time.Minute {
+		t.Errorf("state.earnedRest(), want: 30m, got: %v", got)
+	}
+
+	state.changeModeAtLocked("rest", "", time.Time{})
+	mockClock.now = mockClock.now.Add(45 * time.Minute)
+	if got := state.earnedRest(clock.Now()); got != -15*time.Minute {
+		t.Errorf("state.earnedRest(), want: -15m, got: %v", got)
+	}
+}
+
+func Test_State_toJson_ratio(t *testing.T) {
+	state := State{
+		work:      30 * time.Second,
+		rest:      5 * time.Second,
+		mode:      Off,
+		modeStart: clock.Now(),
+		ratio:     3,
+	}
+
+	want := `{"mode": "off", "work": 30.00, "rest": 5.00, "modeStart": 0, "ratio": 3.00, "earned": 5.00}`
+	if got := state.toJson(); got != want {
+		t.Errorf("state.toJson(), want: %v, got: %v", want, got)
+	}
+}
+
+func Test_State_setRatio(t *testing.T) {
+	state := State{ratio: 3}
+
+	for _, ratio := range []float64{-1, 0, maxRatio + 1, 3} {
+		if state.setRatioLocked(ratio) {
+			t.Errorf("state.setRatioLocked(%v), want: false, got: true", ratio)
+		}
+	}
+	if !state.setRatioLocked(2.5) || state.ratio != 2.5 {
+		t.Errorf("state.setRatioLocked(2.5), want: true and ratio 2.5, got: %v", state.ratio)
+	}
+}
+
+func Test_handleJsonRequest_ratio(t *testing.T) {
+	saved := state.snapshot()
+	defer func() {
+		state.restore(saved)
+		state.initRatio(saved.Ratio)
+	}()
+	state.initRatio(3)
+
+	handleJsonRequest(&JsonRequest{Ratio: 4}, HostInfo{})
+	if state.ratio != 4 {
+		t.Errorf("handleJsonRequest(), want: ratio 4, got: %v", state.ratio)
+	}
+}
+
+func Test_State_restore_ratio(t *testing.T) {
+	state := State{ratio: 3}
+
+	// Snapshots without the ratio keep the current one.
+	if err := state.restore(&StateSnapshot{Mode: "off"}); err != nil || state.ratio != 3 {
+		t.Errorf("state.restore(), want: ratio 3, got: %v, %v", state.ratio, err)
+	}
+	if err := state.restore(&StateSnapshot{Mode: "off", Ratio: 2}); err != nil || state.ratio != 2 {
+		t.Errorf("state.restore(), want: ratio 2, got: %v, %v", state.ratio, err)
+	}
+	if err := state.restore(&StateSnapshot{Mode: "off", Ratio: -2}); err == nil {
+		t.Errorf("state.restore(), want: error for negative ratio, got: nil")
+	}
+}
+
+func Test_flagPassed(t *testing.T) {
+	if flagPassed("no-such-flag") {
+		t.Errorf("flagPassed(), want: false for an unknown flag, got: true")
+	}
+	// Setting the flag to its default value still counts as setting it.
+	flag.Set("ratio", "3")
+	if !flagPassed("ratio") {
+		t.Errorf("flagPassed(), want: true for -ratio, got: false")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Rollover is a goroutine closing each day at its end: it stores the day's
+// totals in the database (if enabled), and resets the State for the new day.
+type Rollover struct {
+	reset   bool          // Whether the State is reset, or only the totals stored.
+	quit    chan struct{} // Closed to request the goroutine to stop.
+	stopped chan struct{} // Closed when the goroutine has stopped.
+}
+
+// Starts the rollover goroutine. When 'reset' is not set, and the database is
+// not enabled, there's nothing to do at the end of the day.
+func startRollover(db *Database, reset bool) *Rollover {
+	r := &Rollover{reset: reset, quit: make(chan struct{}), stopped: make(chan struct{})}
+	state.Lock()
+	state.rollover = reset
+	state.Unlock()
+	if !reset && db == nil {
+		close(r.stopped)
+		return r
+	}
+
+	go func() {
+		defer close(r.stopped)
+		for {
+			now := time.Now()
+			// Close the previous day first, if the State is left over from it
+			// (e.g. restored after the server was down at the day boundary).
+			if start := dayStart(now); r.reset && state.startedBefore(start) {
+				r.closeDay(db, start)
+			}
+
+			boundary := nextDayStart(now)
+			slog.Info("next daily rollover at:", "date", boundary, "day", formatDate(now))
+			timer := time.NewTimer(boundary.Sub(now))
+
+			select {
+			case <-timer.C:
+				r.closeDay(db, boundary)
+			case <-r.quit: // Request to stop (server shutdown).
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Stops the rollover goroutine and blocks until it exits.
+func (r *Rollover) stop() {
+	close(r.quit)
+	<-r.stopped
+	slog.Info("daily rollover has stopped.")
+}
+
+// Stores the totals of the day ending at the boundary, and resets the State if
+// necessary.
+func (r *Rollover) closeDay(db *Database, boundary time.Time) {
+	if !r.reset {
+		if err := db.StoreDailyTotals(&state, boundary.Add(-time.Nanosecond)); err != nil {
+			slog.Error("failed to update the daily total.", "err", err)
+			metrics.dbError("store_day")
+		}
+		return
+	}
+
+	state.Lock()
+	state.splitDays(boundary)
+	state.Unlock()
+	if storeClosedDays(db) {
+		saveState()
+		clients.broadcast(state.toJson())
+	}
+}
+
+// Returns 'true' if the current mode started before 't'.
+func (state *State) startedBefore(t time.Time) bool {
+	state.Lock()
+	defer state.Unlock()
+	return state.modeStart.Before(t)
+}
+
+// A day closed at its end by splitDays(), waiting to be stored.
+type closedDay struct {
+	day        DayTotal
+	transition *Transition // Resets the day's totals.
+}
+
+// Splits the time since 'modeStart' at each day boundary up to 'now', so that
+// every day gets exactly the time elapsed within it. The current mode and tag
+// carry over into the next day.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) splitDays(now time.Time) {
+	if state.modeStart.IsZero() {
+		return
+	}
+	for boundary := nextDayStart(state.modeStart); !boundary.After(now); boundary = nextDayStart(boundary) {
+		state.accumulate(boundary)
+		state.endDay(boundary)
+	}
+}
+
+// Closes the day ending at the boundary: moves its totals to 'closed', and
+// resets work, rest, tags and modes. Days without any time logged are skipped.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) endDay(boundary time.Time) {
+	day := DayTotal{
+		Date:  formatDate(boundary.Add(-time.Nanosecond)),
+		Work:  state.work,
+		Rest:  state.rest,
+		Tags:  state.tags,
+		Modes: state.modeTotals,
+	}
+	if day.isEmpty() {
+		return
+	}
+
+	state.work, state.rest = 0, 0
+	state.tags, state.modeTotals = nil, nil
+	// The changes before the boundary can't be undone, as the day is closed.
+	state.history = History{}
+	mode := state.mode.toString()
+	state.closed = append(state.closed, closedDay{day, &Transition{
+		Time: boundary, From: mode, To: mode, Tag: state.tag, Work: negated(day.Work), Rest: negated(day.Rest)}})
+}
+
+// Stores the days closed since the last call in the database (if enabled), logs
+// their transitions and notifies the webhooks. Returns 'true' if there were any.
+func storeClosedDays(db *Database) bool {
+	state.Lock()
+	closed := state.closed
+	state.closed = nil
+	state.Unlock()
+
+	for _, c := range closed {
+		slog.Info("day rollover.", "day", c.day.Date, "work", c.day.Work, "rest", c.day.Rest)
+		if db != nil {
+			if err := db.StoreDay(c.day); err != nil {
+				slog.Error("failed to update the daily total.", "err", err)
+				metrics.dbError("store_day")
+			}
+		}
+		c.transition.Host = "rollover"
+		logTransition(c.transition)
+		webhooks.notify("rollover", c.transition, &c.day)
+	}
+	return len(closed) > 0
+}
+
+// Returns the start of the in-progress interval counted for the cutoff's day,
+// and 'true' if the accumulated totals are from a previous day not closed yet.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) intervalStart(cutoff time.Time) (time.Time, bool) {
+	if state.rollover && !state.modeStart.IsZero() {
+		if start := dayStart(cutoff); state.modeStart.Before(start) {
+			return start, true
+		}
+	}
+	return state.modeStart, false
+}
+
+// Returns the negated duration as a patch string, or an empty string for 0.
+func negated(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return (-d).String()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_dayStart(t *testing.T) {
+	now := time.Date(2025, 5, 31, 13, 14, 15, 16, time.UTC)
+	if got, want := dayStart(now), time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("dayStart(), want: %v, got: %v", want, got)
+	}
+}
+
+func Test_State_splitDays(t *testing.T) {
+	boundary := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state := State{
+		work:      time.Hour,
+		rest:      10 * time.Minute,
+		mode:      Work,
+		modeStart: boundary.Add(-30 * time.Minute),
+		rollover:  true,
+		tag:       "a",
+		tags:      map[string]time.Duration{"a": time.Hour},
+	}
+
+	state.splitDays(boundary)
+	want := DayTotal{
+		Date: formatDate(boundary.AddDate(0, 0, -1)),
+		Work: 90 * time.Minute,
+		Rest: 10 * time.Minute,
+		Tags: map[string]time.Duration{"a": 90 * time.Minute},
+	}
+	if len(state.closed) != 1 || !reflect.DeepEqual(state.closed[0].day, want) {
+		t.Fatalf("state.splitDays(), want: %v, got: %v", want, state.closed)
+	}
+	wantTransition := Transition{
+		Time: boundary, From: "work", To: "work", Tag: "a", Work: "-1h30m0s", Rest: "-10m0s"}
+	if transition := state.closed[0].transition; *transition != wantTransition {
+		t.Errorf("state.splitDays(), want: %v, got: %v", wantTransition, transition)
+	}
+
+	// The mode and the tag carry over, starting at the boundary.
+	wantState := State{mode: Work, modeStart: boundary, rollover: true, tag: "a"}
+	if !sameState(&state, &wantState) {
+		t.Errorf("state.splitDays(), want: %s, got: %s", &wantState, &state)
+	}
+
+	// Nothing to split the second time.
+	if state.splitDays(boundary); len(state.closed) != 1 {
+		t.Errorf("state.splitDays(), want: 1 closed day, got: %v", state.closed)
+	}
+}
+
+func Test_State_changeMode_acrossMidnight(t *testing.T) {
+	boundary := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state := State{mode: Work, modeStart: boundary.Add(-time.Hour), rollover: true}
+
+	// The mode changes after the boundary, before the rollover happens.
+	saved := mockClock.now
+	defer func() { mockClock.now = saved }()
+	mockClock.now = boundary.Add(20 * time.Minute)
+	state.changeModeAtLocked("rest", "", time.Time{})
+
+	if len(state.closed) != 1 || state.closed[0].day.Work != time.Hour {
+		t.Errorf("state.changeModeAtLocked(), want: 1h of work closed, got: %v", state.closed)
+	}
+	if state.work != 20*time.Minute || state.rest != 0 {
+		t.Errorf("state.changeModeAtLocked(), want: 20m of work in the new day, got: %s", &state)
+	}
+}
+
+func Test_State_splitDays_severalDays(t *testing.T) {
+	start := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state := State{mode: Rest, modeStart: start.Add(-time.Hour)}
+
+	// E.g. the State restored after the server was down for two days.
+	state.splitDays(start.AddDate(0, 0, 2))
+	var got []time.Duration
+	for _, c := range state.closed {
+		got = append(got, c.day.Rest)
+	}
+	if want := []time.Duration{time.Hour, 24 * time.Hour, 24 * time.Hour}; !reflect.DeepEqual(got, want) {
+		t.Errorf("state.splitDays(), want: %v of rest, got: %v", want, got)
+	}
+	if date := formatDate(start.AddDate(0, 0, 1)); state.closed[2].day.Date != date {
+		t.Errorf("state.splitDays(), want last day: %s, got: %s", date, state.closed[2].day.Date)
+	}
+}
+
+func Test_State_getTotalDurations_acrossMidnight(t *testing.T) {
+	boundary := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state := State{
+		work:      time.Hour,
+		mode:      Work,
+		modeStart: boundary.Add(-time.Hour),
+		rollover:  true,
+		tag:       "a",
+		tags:      map[string]time.Duration{"a": time.Hour},
+	}
+
+	// Only the time after the boundary counts, before the day is closed.
+	cutoff := boundary.Add(15 * time.Minute)
+	if work, rest := state.getTotalDurations(cutoff); work != 15*time.Minute || rest != 0 {
+		t.Errorf("state.getTotalDurations(), want: 15m0s, 0s, got: %v, %v", work, rest)
+	}
+	if tags := state.getTagTotals(cutoff); tags["a"] != 15*time.Minute {
+		t.Errorf("state.getTagTotals(), want: 15m of 'a', got: %v", tags)
+	}
+	if work, _ := state.getTotalDurations(boundary.Add(-time.Minute)); work != 119*time.Minute {
+		t.Errorf("state.getTotalDurations(), want: 1h59m0s, got: %v", work)
+	}
+
+	// Without '-rollover', the totals keep accumulating across days.
+	state.rollover = false
+	if work, _ := state.getTotalDurations(cutoff); work != 135*time.Minute {
+		t.Errorf("state.getTotalDurations(), want: 2h15m0s, got: %v", work)
+	}
+}
+
+func Test_Rollover_closeDay(t *testing.T) {
+	db := createDB(t)
+	saved := state.snapshot()
+	defer state.restore(saved)
+
+	boundary := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state.restore(&StateSnapshot{Work: 2 * time.Hour, Mode: "off", ModeStart: boundary.Add(-time.Hour)})
+
+	r := Rollover{reset: true}
+	r.closeDay(db, boundary)
+
+	date := formatDate(boundary.AddDate(0, 0, -1))
+	days, _ := db.ReadDays(date, date)
+	if len(days) != 1 || days[0].Work != 2*time.Hour {
+		t.Errorf("db.ReadDays(), want: 2h of work, got: %v", days)
+	}
+	if work, rest := state.getTotalDurations(boundary); work != 0 || rest != 0 {
+		t.Errorf("state.getTotalDurations(), want: 0s, 0s, got: %v, %v", work, rest)
+	}
+}
+
+func Test_StoreDay_sameTotals(t *testing.T) {
+	db := createDB(t)
+
+	// Separate days can have the same totals, e.g. when closed by the rollover.
+	days := []DayTotal{
+		{Date: "2025-05-30", Work: time.Hour, Tags: map[string]time.Duration{"a": time.Hour}},
+		{Date: "2025-05-31", Work: time.Hour, Tags: map[string]time.Duration{"b": time.Hour}},
+	}
+	for _, d := range days {
+		if err := db.StoreDay(d); err != nil {
+			t.Fatalf("db.StoreDay(), unexpected error: %v", err)
+		}
+	}
+	if got, _ := db.ReadDays("2025-05-30", "2025-05-31"); !reflect.DeepEqual(got, days) {
+		t.Errorf("db.ReadDays(), want: %v, got: %v", days, got)
+	}
+}
+
+func Test_State_endDay_noneModes(t *testing.T) {
+	withModes(t, breakMode)
+	boundary := dayStart(clock.Now()).AddDate(0, 0, 1)
+	state := State{mode: *modeFromString("break"), modeStart: boundary.Add(-time.Hour), rollover: true}
+
+	// A day with only the time in 'break', counting as neither work nor rest.
+	state.splitDays(boundary)
+	want := DayTotal{Date: formatDate(boundary.AddDate(0, 0, -1)), Modes: map[string]time.Duration{"break": time.Hour}}
+	if len(state.closed) != 1 || !reflect.DeepEqual(state.closed[0].day, want) {
+		t.Fatalf("state.splitDays(), want: %v, got: %v", want, state.closed)
+	}
+	if state.modeTotals != nil {
+		t.Errorf("state.splitDays(), want: no mode totals, got: %v", state.modeTotals)
+	}
+
+	// The day is stored with its modes.
+	db := createDB(t)
+	if err := db.StoreDay(want); err != nil {
+		t.Fatalf("db.StoreDay(), unexpected error: %v", err)
+	}
+	if got, _ := db.ReadDays(want.Date, want.Date); len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("db.ReadDays(), want: %v, got: %v", want, got)
+	}
+}
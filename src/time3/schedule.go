@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is an automatic cycle of work and rest intervals, like Pomodoro.
+type Schedule struct {
+	Name     string
+	Work     time.Duration
+	Rest     time.Duration
+	LongRest time.Duration // Rest after every 'Cycles' work intervals, if 'Cycles' > 0.
+	Cycles   int
+}
+
+// The known schedules, configured by the '-schedule-*' flags.
+var schedules = map[string]*Schedule{}
+
+// Parses the schedule intervals in 'work,rest[,longRest,cycles]' format.
+func parseSchedule(name string, spec string) (*Schedule, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return nil, fmt.Errorf("Invalid '%s' schedule: '%s'.", name, spec)
+	}
+
+	var durations []time.Duration
+	for _, part := range parts[:min(len(parts), 3)] {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("Invalid '%s' schedule interval: '%s'.", name, part)
+		}
+		durations = append(durations, d)
+	}
+
+	result := Schedule{Name: name, Work: durations[0], Rest: durations[1]}
+	if len(parts) == 4 {
+		cycles, err := strconv.Atoi(strings.TrimSpace(parts[3]))
+		if err != nil || cycles < 1 {
+			return nil, fmt.Errorf("Invalid '%s' schedule cycles: '%s'.", name, parts[3])
+		}
+		result.LongRest, result.Cycles = durations[2], cycles
+	}
+	return &result, nil
+}
+
+// Configures the known schedules from the flags.
+func configureSchedules() error {
+	for name, spec := range map[string]string{"pomodoro": *pomodoroFlag, "52-17": *fiftyTwoFlag} {
+		schedule, err := parseSchedule(name, spec)
+		if err != nil {
+			return err
+		}
+		schedules[name] = schedule
+	}
+	return nil
+}
+
+// ScheduleState tracks the progress of the running schedule.
+type ScheduleState struct {
+	schedule *Schedule
+	cycle    int         // Number of work intervals started so far.
+	next     time.Time   // Time of the next automatic transition.
+	nextMode ModeType    // Mode after the next transition.
+	timer    *time.Timer // Fires at 'next'.
+	warning  *time.Timer // Fires '-schedule-warning' before 'next'.
+}
+
+// Returns the ScheduleState as a JSON string, 'in' is in milliseconds from now.
+func (s *ScheduleState) toJson() string {
+	return fmt.Sprintf(`{"name": %s, "cycle": %d, "next": "%s", "in": %d}`,
+		jsonString(s.schedule.Name), s.cycle, s.nextMode.toString(), s.next.Sub(clock.Now()).Milliseconds())
+}
+
+// Starts, stops or skips the schedule depending on the command. Returns the
+// resulting Transition (if any), and 'false' if nothing was changed.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) controlScheduleLocked(command string) (*Transition, bool) {
+	switch command {
+	case "stop":
+		if state.schedule == nil {
+			return nil, false
+		}
+		state.stopSchedule()
+		return nil, true
+	case "skip":
+		if state.schedule == nil {
+			return nil, false
+		}
+		return state.advanceSchedule(), true
+	}
+
+	schedule := schedules[command]
+	if schedule == nil {
+		slog.Info("unknown schedule specified, ignoring.", "schedule", command)
+		return nil, false
+	}
+	state.stopSchedule()
+	state.schedule = &ScheduleState{schedule: schedule, nextMode: Work}
+	return state.advanceSchedule(), true
+}
+
+// Stops the running schedule, if any.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) stopSchedule() {
+	if state.schedule == nil {
+		return
+	}
+	state.schedule.stopTimers()
+	state.schedule = nil
+}
+
+func (s *ScheduleState) stopTimers() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.warning != nil {
+		s.warning.Stop()
+	}
+}
+
+// Switches to the next mode of the schedule, and plans the following transition.
+// Returns the resulting Transition, or nil if the mode was already the next one.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) advanceSchedule() *Transition {
+	s := state.schedule
+	s.stopTimers()
+
+	mode := s.nextMode
+	var duration time.Duration
+	if mode == Work {
+		s.cycle++
+		duration, s.nextMode = s.schedule.Work, Rest
+	} else if s.schedule.Cycles > 0 && s.cycle%s.schedule.Cycles == 0 {
+		duration, s.nextMode = s.schedule.LongRest, Work
+	} else {
+		duration, s.nextMode = s.schedule.Rest, Work
+	}
+
+	// The tag (if any) is kept for the following work intervals.
+	transition := state.switchMode(mode, state.tag)
+	s.next = clock.Now().Add(duration)
+
+	next := s.next
+	s.timer = time.AfterFunc(duration, func() { onScheduleTimer(s, next) })
+	if warning := *scheduleWarningFlag; warning > 0 && warning < duration {
+		s.warning = time.AfterFunc(duration-warning, func() { onScheduleWarning(s, next) })
+	}
+	return transition
+}
+
+// Performs the scheduled transition, unless the schedule was changed since the
+// timer was set.
+func onScheduleTimer(s *ScheduleState, next time.Time) {
+	state.Lock()
+	if state.schedule != s || !s.next.Equal(next) {
+		state.Unlock()
+		return
+	}
+	transition := state.advanceSchedule()
+	state.Unlock()
+
+	slog.Info("scheduled transition.", "schedule", s.schedule.Name, "transition", transition)
+	publishChange(transition, "scheduler", false)
+}
+
+// Warns all the clients about the upcoming scheduled transition.
+func onScheduleWarning(s *ScheduleState, next time.Time) {
+	state.Lock()
+	if state.schedule != s || !s.next.Equal(next) {
+		state.Unlock()
+		return
+	}
+	msg := fmt.Sprintf(`{"event": "countdown", "next": "%s", "in": %d}`,
+		s.nextMode.toString(), next.Sub(clock.Now()).Milliseconds())
+	state.Unlock()
+
+	clients.broadcastTransient(msg)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseSchedule(t *testing.T) {
+	got, err := parseSchedule("pomodoro", "25m, 5m, 15m, 4")
+	want := Schedule{"pomodoro", 25 * time.Minute, 5 * time.Minute, 15 * time.Minute, 4}
+	if err != nil || *got != want {
+		t.Errorf("parseSchedule(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	got, err = parseSchedule("52-17", "52m,17m")
+	want = Schedule{Name: "52-17", Work: 52 * time.Minute, Rest: 17 * time.Minute}
+	if err != nil || *got != want {
+		t.Errorf("parseSchedule(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	for _, spec := range []string{"", "25m", "25m,5m,15m", "25m,-5m", "25m,5m,15m,0", "25m,5m,argh,4"} {
+		if _, err := parseSchedule("argh", spec); err == nil {
+			t.Errorf("parseSchedule(%s), want: error, got: nil", spec)
+		}
+	}
+}
+
+func Test_State_controlSchedule(t *testing.T) {
+	schedules["test"] = &Schedule{"test", 10 * time.Minute, 2 * time.Minute, 5 * time.Minute, 2}
+	defer delete(schedules, "test")
+
+	state := State{mode: Off, modeStart: clock.Now()}
+	defer state.controlScheduleLocked("stop")
+
+	// Starting the schedule switches to work right away.
+	transition, ok := state.controlScheduleLocked("test")
+	if !ok || transition == nil || transition.To != "work" || state.mode != Work {
+		t.Fatalf("state.controlScheduleLocked(), want: transition to work, got: %v, %v", transition, ok)
+	}
+	if want := clock.Now().Add(10 * time.Minute); !state.schedule.next.Equal(want) {
+		t.Errorf("state.controlScheduleLocked(), want next at: %v, got: %v", want, state.schedule.next)
+	}
+
+	// Work, rest, work and then the long rest after the second cycle.
+	for _, want := range []struct {
+		mode     ModeType
+		duration time.Duration
+	}{{Rest, 2 * time.Minute}, {Work, 10 * time.Minute}, {Rest, 5 * time.Minute}, {Work, 10 * time.Minute}} {
+		mockClock.now = mockClock.now.Add(time.Minute)
+		if _, ok := state.controlScheduleLocked("skip"); !ok {
+			t.Fatalf("state.controlScheduleLocked(skip), want: true, got: false")
+		}
+		if state.mode != want.mode || !state.schedule.next.Equal(clock.Now().Add(want.duration)) {
+			t.Errorf("state.controlScheduleLocked(skip), want: %s for %v, got: %s until %v",
+				want.mode.toString(), want.duration, state.mode.toString(), state.schedule.next)
+		}
+	}
+	if state.schedule.cycle != 3 {
+		t.Errorf("state.schedule.cycle, want: 3, got: %d", state.schedule.cycle)
+	}
+
+	if _, ok := state.controlScheduleLocked("stop"); !ok || state.schedule != nil {
+		t.Errorf("state.controlScheduleLocked(stop), want: no schedule, got: %v", state.schedule)
+	}
+	if _, ok := state.controlScheduleLocked("skip"); ok {
+		t.Errorf("state.controlScheduleLocked(skip), want: false without schedule, got: true")
+	}
+	if _, ok := state.controlScheduleLocked("argh"); ok {
+		t.Errorf("state.controlScheduleLocked(argh), want: false, got: true")
+	}
+}
+
+func Test_State_changeMode_stopsSchedule(t *testing.T) {
+	schedules["test"] = &Schedule{Name: "test", Work: 10 * time.Minute, Rest: 2 * time.Minute}
+	defer delete(schedules, "test")
+
+	state := State{mode: Off, modeStart: clock.Now()}
+	state.controlScheduleLocked("test")
+
+	// Changing only the tag keeps the schedule running.
+	state.changeModeAtLocked("", "a", time.Time{})
+	if state.schedule == nil {
+		t.Errorf("state.changeModeAtLocked(), want: schedule kept, got: nil")
+	}
+	if !strings.Contains(state.toJson(), `"schedule": {"name": "test", "cycle": 1, "next": "rest", "in": 600000}`) {
+		t.Errorf("state.toJson(), want: schedule, got: %s", state.toJson())
+	}
+
+	state.changeModeAtLocked("off", "", time.Time{})
+	if state.schedule != nil {
+		t.Errorf("state.changeModeAtLocked(), want: schedule stopped, got: %v", state.schedule)
+	}
+}
+
+func Test_onScheduleTimer_stale(t *testing.T) {
+	schedules["test"] = &Schedule{Name: "test", Work: 10 * time.Minute, Rest: 2 * time.Minute}
+	defer delete(schedules, "test")
+
+	saved := state.snapshot()
+	defer func() {
+		state.Lock()
+		state.controlScheduleLocked("stop")
+		state.Unlock()
+		state.restore(saved)
+	}()
+
+	state.Lock()
+	state.controlScheduleLocked("test")
+	s := state.schedule
+	state.Unlock()
+
+	// A timer for an outdated transition is ignored.
+	onScheduleTimer(s, s.next.Add(-time.Minute))
+	if state.mode != Work || state.schedule.cycle != 1 {
+		t.Errorf("onScheduleTimer(), want: no change, got: %s", &state)
+	}
+
+	onScheduleTimer(s, s.next)
+	if state.mode != Rest {
+		t.Errorf("onScheduleTimer(), want: rest, got: %s", &state)
+	}
+}
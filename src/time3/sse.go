@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Identifies this run of the server in the event ids, so that the ids sent
+// before a restart aren't mistaken for the ones of the new run.
+var instanceID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// Returns the id of the event, as sent to the SSE clients.
+func formatEventID(id uint64) string {
+	return fmt.Sprintf("%s-%d", instanceID, id)
+}
+
+// Parses the 'Last-Event-ID' sent by a reconnecting client. Returns 'false' for
+// malformed ids, and for the ids sent by another run of the server.
+func parseEventID(s string) (uint64, bool) {
+	instance, n, ok := strings.Cut(s, "-")
+	if !ok || instance != instanceID {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(n, 10, 64)
+	return id, err == nil
+}
+
+// How often a comment is sent to idle SSE streams, so that proxies keep them open.
+var sseHeartbeat = 15 * time.Second
+
+// SseClient is a Server-Sent Events stream receiving the broadcast messages.
+type SseClient struct {
+	events      chan event
+	dropped     chan struct{} // Closed when an event is dropped.
+	once        sync.Once
+	connectedAt time.Time
+	remoteAddr  string
+	userAgent   string
+}
+
+// Queues the message for the stream. Fails instead of blocking the broadcast,
+// if the client doesn't keep up: the stream is then closed, so that the client
+// reconnects and resumes from the last event it got.
+func (client *SseClient) notify(id uint64, msg string) error {
+	select {
+	case client.events <- event{id, msg}:
+		return nil
+	default:
+		client.close()
+		return fmt.Errorf("SSE client is too slow, dropping event %d.", id)
+	}
+}
+
+func (client *SseClient) info() ClientInfo {
+	return ClientInfo{Kind: "sse", RemoteAddr: client.remoteAddr, UserAgent: client.userAgent,
+		ConnectedAt: client.connectedAt}
+}
+
+// Closes the stream, as if an event was dropped.
+func (client *SseClient) close() {
+	client.once.Do(func() { close(client.dropped) })
+}
+
+// Writes the event in the 'text/event-stream' format. Transient events have no
+// id, so the client's 'Last-Event-ID' is kept.
+func writeEvent(w io.Writer, e event) error {
+	var b strings.Builder
+	if e.id != 0 {
+		fmt.Fprintf(&b, "id: %s\n", formatEventID(e.id))
+	}
+	for _, line := range strings.Split(e.msg, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	_, err := io.WriteString(w, b.String()+"\n")
+	return err
+}
+
+// Streams the State changes (the same messages as the websocket clients get) as
+// Server-Sent Events. A client reconnecting with the 'Last-Event-ID' header gets
+// the events it missed (if they're still available), followed by the current State.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	logNewPeer(r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disables buffering in nginx.
+
+	lastID, known := parseEventID(r.Header.Get("Last-Event-ID"))
+	client := SseClient{events: make(chan event, 16), dropped: make(chan struct{}),
+		connectedAt: clock.Now(), remoteAddr: r.RemoteAddr, userAgent: r.UserAgent()}
+	missed, stateID, resumed := clients.subscribe(&client, lastID, known)
+	defer clients.remove(&client)
+
+	// The replayed States are relative to the time they were broadcast at (like
+	// 'modeStart'), so the current State always follows them.
+	missed = append(missed, event{stateID, state.toJson()})
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	slog.Debug("SSE stream established.", "resumed", resumed, "missed", len(missed))
+
+	var err error
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e := <-client.events:
+			err = writeEvent(w, e)
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case <-client.dropped:
+			slog.Info("SSE client is too slow, closing.")
+			return
+		case <-r.Context().Done():
+			slog.Debug("SSE client disconnected.")
+			return
+		}
+		if err != nil {
+			slog.Debug("SSE write error, closing.", "error", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
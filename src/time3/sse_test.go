@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Connects to the SSE stream, with the optional 'Last-Event-ID'.
+func openStream(t *testing.T, url string, lastID string) *bufio.Reader {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Get(), unexpected error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("eventsHandler(), want: text/event-stream, got: %s", got)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// Reads the next event (or comment) from the stream, as its lines.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	var result []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString(), unexpected error: %v", err)
+		}
+		if line == "\n" {
+			return result
+		}
+		result = append(result, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// Waits until the number of connected clients reaches 'n'.
+func waitForClients(t *testing.T, n int) {
+	for range 100 {
+		clients.Lock()
+		count := len(clients.clients)
+		clients.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("want: %d clients, but they didn't connect", n)
+}
+
+func Test_eventsHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+
+	stream := openStream(t, server.URL, "")
+	// The current State is sent right away.
+	first := readEvent(t, stream)
+	if len(first) != 2 || first[1] != "data: "+state.toJson() {
+		t.Errorf("eventsHandler(), want: current state, got: %v", first)
+	}
+
+	waitForClients(t, 1)
+	clients.broadcast(`{"event": "test"}`)
+	got := readEvent(t, stream)
+	if len(got) != 2 || !strings.HasPrefix(got[0], "id: ") || got[1] != `data: {"event": "test"}` {
+		t.Errorf("eventsHandler(), want: broadcast event, got: %v", got)
+	}
+}
+
+func Test_eventsHandler_resume(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+
+	clients.broadcast(`{"n": 1}`)
+	clients.Lock()
+	lastID := clients.lastID
+	clients.Unlock()
+	clients.broadcast(`{"n": 2}`)
+	clients.broadcast(`{"n": 3}`)
+
+	// The events after 'Last-Event-ID' are replayed.
+	stream := openStream(t, server.URL, formatEventID(lastID))
+	for _, want := range []string{`data: {"n": 2}`, `data: {"n": 3}`, "data: " + state.toJson()} {
+		if got := readEvent(t, stream); len(got) != 2 || got[1] != want {
+			t.Errorf("eventsHandler(), want: %s, got: %v", want, got)
+		}
+	}
+
+	// Too old to resume, the current State is sent instead.
+	clients.Lock()
+	tooOld := clients.lastID - recentEvents - 1
+	clients.Unlock()
+	for range recentEvents {
+		clients.broadcast(`{"n": 4}`)
+	}
+	stream = openStream(t, server.URL, formatEventID(tooOld))
+	if got := readEvent(t, stream); len(got) != 2 || got[1] != "data: "+state.toJson() {
+		t.Errorf("eventsHandler(), want: current state, got: %v", got)
+	}
+}
+
+func Test_eventsHandler_resumeState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+	saved := state.snapshot()
+	defer state.restore(saved)
+	savedNow := mockClock.now
+	defer func() { mockClock.now = savedNow }()
+
+	state.restore(&StateSnapshot{Mode: "work", ModeStart: clock.Now()})
+	clients.broadcast(state.toJson())
+	clients.Lock()
+	lastID := clients.lastID
+	clients.Unlock()
+	stale := state.toJson()
+	clients.broadcast(stale)
+
+	// The replayed State is followed by the current one, 10 minutes later.
+	mockClock.now = mockClock.now.Add(10 * time.Minute)
+	stream := openStream(t, server.URL, formatEventID(lastID))
+	if got := readEvent(t, stream); len(got) != 2 || got[1] != "data: "+stale {
+		t.Errorf("eventsHandler(), want: the replayed state, got: %v", got)
+	}
+	got := readEvent(t, stream)
+	if len(got) != 2 || got[1] != "data: "+state.toJson() || !strings.Contains(got[1], `"modeStart": 600000`) {
+		t.Errorf("eventsHandler(), want: the current state, got: %v", got)
+	}
+}
+
+func Test_eventsHandler_stateID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+
+	clients.broadcast(`{"n": 1}`)
+	clients.Lock()
+	lastID := clients.lastID
+	clients.Unlock()
+
+	// The current State gets its own id, after the broadcast ones.
+	stream := openStream(t, server.URL, formatEventID(lastID))
+	got := readEvent(t, stream)
+	if len(got) != 2 || got[0] == "id: "+formatEventID(lastID) || got[1] != "data: "+state.toJson() {
+		t.Fatalf("eventsHandler(), want: current state with a new id, got: %v", got)
+	}
+	stateID := strings.TrimPrefix(got[0], "id: ")
+
+	// Transient events have no id, and aren't replayed.
+	waitForClients(t, 1)
+	clients.broadcastTransient(`{"event": "countdown"}`)
+	if got := readEvent(t, stream); len(got) != 1 || got[0] != `data: {"event": "countdown"}` {
+		t.Errorf("eventsHandler(), want: countdown without id, got: %v", got)
+	}
+
+	// Nothing to replay after the State's id.
+	stream = openStream(t, server.URL, stateID)
+	got = readEvent(t, stream)
+	if len(got) != 2 || got[0] == "id: "+stateID || got[1] != "data: "+state.toJson() {
+		t.Errorf("eventsHandler(), want: only the current state, got: %v", got)
+	}
+}
+
+func Test_eventsHandler_unknownID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+
+	clients.broadcast(`{"n": 1}`)
+	clients.broadcast(`{"n": 2}`)
+	// E.g. an id sent before the server restarted.
+	for _, id := range []string{"1", "argh-1", "-1"} {
+		stream := openStream(t, server.URL, id)
+		if got := readEvent(t, stream); len(got) != 2 || got[1] != "data: "+state.toJson() {
+			t.Errorf("eventsHandler(%s), want: current state, got: %v", id, got)
+		}
+	}
+}
+
+func Test_eventsHandler_heartbeat(t *testing.T) {
+	saved := sseHeartbeat
+	sseHeartbeat = 10 * time.Millisecond
+	defer func() { sseHeartbeat = saved }()
+
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	t.Cleanup(server.Close)
+
+	stream := openStream(t, server.URL, "")
+	readEvent(t, stream)
+	if got := readEvent(t, stream); len(got) != 1 || got[0] != ": heartbeat" {
+		t.Errorf("eventsHandler(), want: heartbeat comment, got: %v", got)
+	}
+}
+
+func Test_SseClient_notify_slow(t *testing.T) {
+	client := SseClient{events: make(chan event, 1), dropped: make(chan struct{})}
+	if err := client.notify(1, "a"); err != nil {
+		t.Errorf("client.notify(), unexpected error: %v", err)
+	}
+	if err := client.notify(2, "b"); err == nil {
+		t.Errorf("client.notify(), want: error for a full queue, got: nil")
+	}
+	client.notify(3, "c")
+	select {
+	case <-client.dropped:
+	default:
+		t.Errorf("client.notify(), want: stream closed, got: still open")
+	}
+}
+
+func Test_writeEvent_multiline(t *testing.T) {
+	var b strings.Builder
+	writeEvent(&b, event{7, "a\nb"})
+	if want := "id: " + formatEventID(7) + "\ndata: a\ndata: b\n\n"; b.String() != want {
+		t.Errorf("writeEvent(), want: %q, got: %q", want, b.String())
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"maps"
 	"testing"
 	"time"
 )
@@ -58,7 +59,7 @@ func Test_State_resetModeStart(t *testing.T) {
 		modeStart: clock.Now(), // modeStart: now
 	}
 
-	if state != want {
+	if !sameState(&state, &want) {
 		t.Errorf("state.resetModeStart(), want: %s, got: %s", &want, &state)
 	}
 }
@@ -82,7 +83,7 @@ func Test_State_resetModeStart_backwards(t *testing.T) {
 	mockClock.now = mockClock.now.Add(-10 * time.Hour)
 	state.resetModeStart()
 
-	if state != want {
+	if !sameState(&state, &want) {
 		t.Errorf("state.resetModeStart(), want: %s, got: %s", &want, &state)
 	}
 }
@@ -106,7 +107,7 @@ func Test_State_resetModeStart_off(t *testing.T) {
 
 	state.resetModeStart()
 
-	if state != want {
+	if !sameState(&state, &want) {
 		t.Errorf("state.resetModeStart(), want: %s, got: %s", &want, &state)
 	}
 }
@@ -170,10 +171,10 @@ func Test_patchDurations(t *testing.T) {
 		modeStart: clock.Now(),
 	}
 
-	state.patchDurations( /*work=*/ "-20s" /*rest=*/, "40s")
+	state.patchDurationsLocked( /*work=*/ "-20s" /*rest=*/, "40s")
 
-	if state != want {
-		t.Errorf("patchDurations(), want: %s, got: %s", &want, &state)
+	if !sameState(&state, &want) {
+		t.Errorf("patchDurationsLocked(), want: %s, got: %s", &want, &state)
 	}
 }
 
@@ -193,13 +194,83 @@ func Test_changeMode(t *testing.T) {
 		modeStart: clock.Now(),
 	}
 
-	state.changeMode("rest")
-	if state != want {
-		t.Errorf("patchDurations(), want: %s, got: %s", &want, &state)
+	state.changeModeAtLocked("rest", "", time.Time{})
+	if !sameState(&state, &want) {
+		t.Errorf("changeModeAtLocked(), want: %s, got: %s", &want, &state)
 	}
 
-	state.changeMode("blarrhgh")
-	if state != want {
-		t.Errorf("patchDurations(), want: %s, got: %s", &want, &state)
+	state.changeModeAtLocked("blarrhgh", "", time.Time{})
+	if !sameState(&state, &want) {
+		t.Errorf("changeModeAtLocked(), want: %s, got: %s", &want, &state)
 	}
 }
+
+func Test_changeModeAt(t *testing.T) {
+	start := clock.Now()
+	state := State{work: time.Hour, mode: Work, modeStart: start}
+	mockClock.now = mockClock.now.Add(30 * time.Minute)
+
+	// Forgot to switch to rest 15 minutes ago.
+	at := clock.Now().Add(-15 * time.Minute)
+	transition, err := state.changeModeAtLocked("rest", "", at)
+	if err != nil || transition == nil || !transition.Time.Equal(at) || transition.To != "rest" {
+		t.Fatalf("changeModeAtLocked(), want: transition at %v, got: %v, %v", at, transition, err)
+	}
+	want := State{work: 75 * time.Minute, mode: Rest, modeStart: at}
+	if !sameState(&state, &want) {
+		t.Errorf("changeModeAtLocked(), want: %s, got: %s", &want, &state)
+	}
+	if work, rest := state.getTotalDurations(clock.Now()); work != 75*time.Minute || rest != 15*time.Minute {
+		t.Errorf("getTotalDurations(), want: 1h15m0s, 15m0s, got: %v, %v", work, rest)
+	}
+
+	// Before the current mode started, or in the future.
+	for _, at := range []time.Time{start.Add(time.Minute), clock.Now().Add(time.Second)} {
+		if _, err := state.changeModeAtLocked("off", "", at); err == nil || !sameState(&state, &want) {
+			t.Errorf("changeModeAt(%v), want: error and no change, got: %v, %s", at, err, &state)
+		}
+	}
+}
+
+func Test_JsonRequest_changeTime(t *testing.T) {
+	if at, err := (&JsonRequest{Ago: "15m"}).changeTime(); err != nil || !at.Equal(clock.Now().Add(-15*time.Minute)) {
+		t.Errorf("changeTime(), want: 15m ago, got: %v, %v", at, err)
+	}
+	if at, err := (&JsonRequest{At: "2025-06-01T10:00:00+02:00"}).changeTime(); err != nil || at.Unix() != 1748764800 {
+		t.Errorf("changeTime(), want: 2025-06-01T08:00:00Z, got: %v, %v", at, err)
+	}
+	if at, err := (&JsonRequest{}).changeTime(); err != nil || !at.IsZero() {
+		t.Errorf("changeTime(), want: zero time, got: %v, %v", at, err)
+	}
+	for _, r := range []JsonRequest{{At: "argh"}, {Ago: "-5m"}, {Ago: "5m", At: "2025-06-01T10:00:00Z"}} {
+		if _, err := r.changeTime(); err == nil {
+			t.Errorf("changeTime(%v), want: error, got: nil", r)
+		}
+	}
+}
+
+func Test_handleJsonRequest_backdated(t *testing.T) {
+	saved := state.snapshot()
+	defer state.restore(saved)
+	state.restore(&StateSnapshot{Mode: "work", ModeStart: clock.Now().Add(-time.Hour)})
+
+	if err := handleJsonRequest(&JsonRequest{Work: "10m", Ago: "5m"}, HostInfo{}); err == nil {
+		t.Errorf("handleJsonRequest(), want: error for a backdated patch, got: nil")
+	}
+	if err := handleJsonRequest(&JsonRequest{Mode: "rest", Ago: "2h"}, HostInfo{}); err == nil || state.mode != Work {
+		t.Errorf("handleJsonRequest(), want: error for before the mode start, got: %v", err)
+	}
+	if err := handleJsonRequest(&JsonRequest{Mode: "rest", Ago: "20m"}, HostInfo{}); err != nil || state.mode != Rest {
+		t.Errorf("handleJsonRequest(), want: rest, got: %v, %s", err, &state)
+	}
+	if work, rest := state.getTotalDurations(clock.Now()); work != 40*time.Minute || rest != 20*time.Minute {
+		t.Errorf("getTotalDurations(), want: 40m0s, 20m0s, got: %v, %v", work, rest)
+	}
+}
+
+// Returns 'true' if both states have the same field values.
+func sameState(a, b *State) bool {
+	return a.work == b.work && a.rest == b.rest && a.mode == b.mode &&
+		a.modeStart.Equal(b.modeStart) && a.tag == b.tag && maps.Equal(a.tags, b.tags) &&
+		maps.Equal(a.modeTotals, b.modeTotals)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Maximum length of a tag, longer tags are truncated.
+const maxTagLength = 64
+
+// Colors for the per-tag work segments in the graph, assigned in tag order.
+var tagColors = []color.RGBA{
+	parseColor("#5f3dc4"),
+	parseColor("#1098ad"),
+	parseColor("#9c36b5"),
+	parseColor("#d9480f"),
+	parseColor("#c2255c"),
+	parseColor("#e67700"),
+	parseColor("#364fc7"),
+	parseColor("#0b7285"),
+}
+
+// Returns the tag with surrounding whitespace removed, truncated if necessary.
+func normalizeTag(tag string) string {
+	return truncate(strings.TrimSpace(tag), maxTagLength)
+}
+
+// Adds the work duration to the current tag, if there is one.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) addTagWork(duration time.Duration) {
+	if state.tag == "" {
+		return
+	}
+	if state.tags == nil {
+		state.tags = make(map[string]time.Duration)
+	}
+	state.tags[state.tag] += duration
+}
+
+// Applies the work duration patch to the current tag. Resetting the total work
+// to zero also resets all the tags.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) patchTagWork(workString string) {
+	if state.work == 0 {
+		state.tags = nil
+		return
+	}
+	if state.tag == "" || workString == "" {
+		return
+	}
+	if state.tags == nil {
+		state.tags = make(map[string]time.Duration)
+	}
+	work := state.tags[state.tag]
+	patchDuration(&work, workString)
+	state.tags[state.tag] = work
+}
+
+// Returns the total work duration per tag, including the current session.
+func (state *State) getTagTotals(cutoff time.Time) map[string]time.Duration {
+	state.Lock()
+	defer state.Unlock()
+
+	from, stale := state.intervalStart(cutoff)
+	var result map[string]time.Duration
+	if !stale {
+		result = maps.Clone(state.tags)
+	}
+	if duration := cutoff.Sub(from); state.mode.counts() == CountsWork && state.tag != "" && duration > 0 {
+		if result == nil {
+			result = make(map[string]time.Duration)
+		}
+		result[state.tag] += duration
+	}
+	return result
+}
+
+// Returns the string as a quoted JSON string.
+func jsonString(s string) string {
+	result, _ := json.Marshal(s)
+	return string(result)
+}
+
+// Returns the durations as a JSON object with values in seconds, and keys sorted.
+func jsonSeconds(durations map[string]time.Duration) string {
+	var fields []string
+	for _, k := range slices.Sorted(maps.Keys(durations)) {
+		fields = append(fields, fmt.Sprintf(`%s: %.2f`, jsonString(k), durations[k].Seconds()))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Returns the durations converted to seconds, or nil if there are none.
+func toSeconds(durations map[string]time.Duration) map[string]float64 {
+	if len(durations) == 0 {
+		return nil
+	}
+	result := make(map[string]float64, len(durations))
+	for k, v := range durations {
+		result[k] = v.Seconds()
+	}
+	return result
+}
+
+// Returns the seconds converted to durations, or nil if there are none.
+func fromSeconds(seconds map[string]float64) map[string]time.Duration {
+	if len(seconds) == 0 {
+		return nil
+	}
+	result := make(map[string]time.Duration, len(seconds))
+	for k, v := range seconds {
+		result[k] = time.Duration(v * float64(time.Second))
+	}
+	return result
+}
+
+// Per-day work time for each tag, stored in the 'day_tags' table.
+var tagBreakdown = breakdown{table: "day_tags", key: "tag", value: "work"}
+
+// Replaces the per-tag work durations stored for the day, if the day itself is
+// stored in the 'days' table.
+func (db *Database) StoreTags(date string, tags map[string]time.Duration) error {
+	return db.storeBreakdown(tagBreakdown, date, tags)
+}
+
+// Returns the chart series and per-day values with the tagged work stacked
+// separately on top of the untagged work.
+func splitByTags(days []DayTotal) ([]series, func(DayTotal) []float64) {
+	var tags []string
+	for _, d := range days {
+		for tag := range d.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+
+	result := []series{{"work", workColor}}
+	for i, tag := range tags {
+		result = append(result, series{tag, tagColors[i%len(tagColors)]})
+	}
+	result = append(result, series{"rest", restColor})
+
+	return result, func(total DayTotal) []float64 {
+		untagged := total.Work
+		values := []float64{0}
+		for _, tag := range tags {
+			values = append(values, total.Tags[tag].Hours())
+			untagged -= total.Tags[tag]
+		}
+		values[0] = max(untagged, 0).Hours()
+		return append(values, total.Rest.Hours())
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_changeModeTagged(t *testing.T) {
+	state := State{mode: Off, modeStart: clock.Now()}
+
+	// Start working on "a".
+	tr, _ := state.changeModeAtLocked("work", " a ", time.Time{})
+	if tr == nil || tr.Tag != "a" || state.tag != "a" {
+		t.Errorf("state.changeModeAtLocked(), want tag: a, got: %+v, %s", tr, &state)
+	}
+
+	// Switch to "b" while still working, 10s are attributed to "a".
+	mockClock.now = mockClock.now.Add(10 * time.Second)
+	tr, _ = state.changeModeAtLocked("", "b", time.Time{})
+	if tr == nil || tr.From != "work" || tr.To != "work" || tr.Tag != "b" {
+		t.Errorf("state.changeModeAtLocked(), want: work -> work (b), got: %+v", tr)
+	}
+
+	// Same mode and tag: no transition.
+	if tr, _ := state.changeModeAtLocked("work", "b", time.Time{}); tr != nil {
+		t.Errorf("state.changeModeAtLocked(), want: nil, got: %+v", tr)
+	}
+
+	// Rest without a tag, 20s are attributed to "b".
+	mockClock.now = mockClock.now.Add(20 * time.Second)
+	state.changeModeAtLocked("rest", "", time.Time{})
+
+	want := map[string]time.Duration{"a": 10 * time.Second, "b": 20 * time.Second}
+	if !maps.Equal(state.tags, want) || state.work != 30*time.Second || state.tag != "" {
+		t.Errorf("state.changeModeAtLocked(), want tags: %v, got: %s", want, &state)
+	}
+}
+
+func Test_getTagTotals(t *testing.T) {
+	state := State{
+		work:      time.Minute,
+		mode:      Work,
+		modeStart: clock.Now(),
+		tag:       "a",
+		tags:      map[string]time.Duration{"a": 10 * time.Second, "b": 50 * time.Second},
+	}
+
+	got := state.getTagTotals(clock.Now().Add(5 * time.Second))
+	want := map[string]time.Duration{"a": 15 * time.Second, "b": 50 * time.Second}
+	if !maps.Equal(got, want) {
+		t.Errorf("state.getTagTotals(), want: %v, got: %v", want, got)
+	}
+	// The state itself is not modified.
+	if state.tags["a"] != 10*time.Second {
+		t.Errorf("state.getTagTotals() modified the state: %s", &state)
+	}
+}
+
+func Test_patchDurations_tags(t *testing.T) {
+	state := State{
+		work:      time.Minute,
+		mode:      Rest,
+		modeStart: clock.Now(),
+		tag:       "a",
+		tags:      map[string]time.Duration{"a": 10 * time.Second, "b": 50 * time.Second},
+	}
+
+	// Work patches apply to the current tag.
+	state.patchDurationsLocked("-20s", "")
+	want := map[string]time.Duration{"a": 0, "b": 50 * time.Second}
+	if !maps.Equal(state.tags, want) {
+		t.Errorf("state.patchDurationsLocked(), want: %v, got: %v", want, state.tags)
+	}
+
+	// Resetting the work resets all tags.
+	state.patchDurationsLocked("-100h", "-100h")
+	if state.tags != nil {
+		t.Errorf("state.patchDurationsLocked(), want: nil tags, got: %v", state.tags)
+	}
+}
+
+func Test_State_toJson_tags(t *testing.T) {
+	state := State{
+		work:      30 * time.Second,
+		mode:      Work,
+		modeStart: clock.Now(),
+		tag:       `"quoted"`,
+		tags:      map[string]time.Duration{`"quoted"`: 10 * time.Second, "b": 20 * time.Second},
+	}
+
+	want := `{"mode": "work", "work": 30.00, "rest": 0.00, "modeStart": 0, "tag": "\"quoted\"",` +
+		` "tags": {"\"quoted\"": 10.00, "b": 20.00}}`
+	if got := state.toJson(); got != want {
+		t.Errorf("state.toJson(), want: %v, got: %v", want, got)
+	}
+}
+
+func Test_StoreTags(t *testing.T) {
+	db := createDB(t)
+	now, _ := time.Parse(time.RFC3339, "2025-05-31T13:14:15Z")
+
+	// Tags are not stored for days that aren't stored.
+	db.StoreTags("2025-05-31", map[string]time.Duration{"a": time.Hour})
+	db.StoreValue(now, 2*time.Hour, 0)
+	days, _ := db.ReadDays("2025-05-31", "2025-05-31")
+	if days[0].Tags != nil {
+		t.Errorf("db.ReadDays(), want: no tags, got: %v", days[0].Tags)
+	}
+
+	// Tags replace the previously stored ones.
+	db.StoreTags("2025-05-31", map[string]time.Duration{"a": time.Hour, "b": time.Minute})
+	db.StoreTags("2025-05-31", map[string]time.Duration{"a": 2 * time.Hour})
+	days, _ = db.ReadDays("2025-05-30", "2025-06-01")
+	want := []DayTotal{{Date: "2025-05-31", Work: 2 * time.Hour, Tags: map[string]time.Duration{"a": 2 * time.Hour}}}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("db.ReadDays(), want: %v, got: %v", want, days)
+	}
+}
+
+func Test_StoreDailyTotals_tags(t *testing.T) {
+	db := createDB(t)
+	state := State{
+		work:      time.Hour,
+		mode:      Work,
+		modeStart: clock.Now(),
+		tag:       "a",
+	}
+
+	if err := db.StoreDailyTotals(&state, clock.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("db.StoreDailyTotals(), unexpected error: %v", err)
+	}
+	date := formatDate(clock.Now())
+	days, _ := db.ReadDays(date, date)
+	if len(days) != 1 || days[0].Work != 2*time.Hour || days[0].Tags["a"] != time.Hour {
+		t.Errorf("db.ReadDays(), want: 2h work with 1h tagged 'a', got: %v", days)
+	}
+}
+
+func Test_newDailyChart_tags(t *testing.T) {
+	db := createDB(t)
+	db.ImportDays([]DayTotal{{
+		Date: "2025-05-31",
+		Work: 3 * time.Hour,
+		Rest: time.Hour,
+		Tags: map[string]time.Duration{"b": time.Hour, "a": 30 * time.Minute},
+	}}, true)
+
+	opts, _ := newOptions("2025-05-31", 1, 400, 300)
+	opts.split = "tags"
+	c := newDailyChart(db, opts)
+
+	var names []string
+	for _, s := range c.series {
+		names = append(names, s.name)
+	}
+	if want := []string{"work", "a", "b", "rest"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("newDailyChart().series, want: %v, got: %v", want, names)
+	}
+	if want := [][]float64{{1.5, 0.5, 1, 1}}; !reflect.DeepEqual(c.values, want) {
+		t.Errorf("newDailyChart().values, want: %v, got: %v", want, c.values)
+	}
+}
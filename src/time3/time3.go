@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
@@ -32,15 +33,81 @@ var verboseFlag = flag.Bool("v", false, "Set to 'true' for more verbose logging.
 
 var dbFlag = flag.String("db", "", "Database file to use. Database is not enabled when not set.")
 
+var importFlag = flag.String("import", "", "A '.csv' or '.json' file with daily totals to import into"+
+	" the database specified by '-db'. The server exits after importing.")
+
+var importModeFlag = flag.String("import-mode", "skip", "Set to 'overwrite' to replace days already in the"+
+	" database when importing, or to 'skip' to keep them.")
+
+var gnuplotFlag = flag.Bool("gnuplot", false, "Set to 'true' to render PNG graphs with 'gnuplot' (if installed)"+
+	" instead of the built-in renderer.")
+
+var stateFlag = flag.String("state", "", "File for persisting the state across restarts, when '-db' is not set."+
+	" State is not persisted when neither is set.")
+
+var authFlag = flag.Bool("auth", false, "Set to 'true' to require API tokens for all requests."+
+	" Tokens are stored in the database specified by '-db'.")
+
+var tokenAddFlag = flag.String("token-add", "", "Creates a new API token with the given name, prints it and exits.")
+
+var tokenScopeFlag = flag.String("token-scope", "read", "Scope of the token created by '-token-add',"+
+	" either 'read' or 'control'.")
+
+var tokenRevokeFlag = flag.String("token-revoke", "", "Revokes the API token with the given name and exits.")
+
+var tokenListFlag = flag.Bool("token-list", false, "Set to 'true' to list all API tokens and exit.")
+
+var ratioFlag = flag.Float64("ratio", 3, "Target work/rest ratio, for computing the earned rest. For example,"+
+	" '3' earns 20 minutes of rest per hour of work, as in 'Third Time'. Set to 0 to disable.")
+
+var pomodoroFlag = flag.String("schedule-pomodoro", "25m,5m,15m,4", "Intervals of the 'pomodoro' schedule:"+
+	" work, rest, long rest, and the number of work intervals before each long rest.")
+
+var fiftyTwoFlag = flag.String("schedule-52-17", "52m,17m", "Intervals of the '52-17' schedule: work and rest,"+
+	" optionally followed by long rest and the number of work intervals before each long rest.")
+
+var scheduleWarningFlag = flag.Duration("schedule-warning", time.Minute, "How long before each scheduled"+
+	" transition to warn the clients about it. Set to 0 to disable the warnings.")
+
+var tzFlag = flag.String("tz", "", "Time zone defining the day boundaries, like 'Europe/Berlin'."+
+	" Defaults to the local time zone of the server.")
+
+var dayStartFlag = flag.String("day-start", "00:00", "Time at which each day starts, in 'HH:MM' format."+
+	" For example, with '04:00' the work done until 4am counts towards the previous day.")
+
+var rolloverFlag = flag.Bool("rollover", true, "Set to 'false' to keep accumulating work/rest across days,"+
+	" instead of resetting them at the end of each day.")
+
+var modesFlag = flag.String("modes", "", "JSON file with user-defined modes in addition to 'work', 'rest' and 'off',"+
+	` like '[{"name": "meeting", "counts": "work", "color": "#5f3dc4"}]'. Modes count as 'work', 'rest' or 'none'.`)
+
+var webhooksFlag = flag.String("webhooks", "", "JSON file with webhook targets receiving the state changes,"+
+	` like '[{"url": "https://example.com/hook", "secret": "..."}]'. Payloads are signed with HMAC-SHA256 of the secret.`)
+
+var webhookTimeoutFlag = flag.Duration("webhook-timeout", 5*time.Second, "Timeout of each webhook delivery attempt.")
+
+var webhookRetriesFlag = flag.Int("webhook-retries", 3, "Number of retries of the failed webhook deliveries,"+
+	" with exponential backoff starting at 1s.")
+
+var wsPingFlag = flag.Duration("ws-ping", 30*time.Second, "How often the websocket clients are pinged. Clients"+
+	" not responding for two intervals are disconnected. Set to 0 to disable the pings.")
+
+var wsWriteTimeoutFlag = flag.Duration("ws-write-timeout", 10*time.Second, "Timeout of each write to a websocket"+
+	" client. Clients not accepting the writes in time are disconnected.")
+
 //go:embed template.html
 //go:embed tomato.ico
+//go:embed admin_hosts.html
 var f embed.FS
 
 // Maintains a map of all currently connected clients.
 var clients = WsClients{
-	clients: make(map[*WsClient]int),
+	clients: make(map[subscriber]int),
 }
 
+// The database, nil when not enabled.
+var db *Database
+
 // Clock interface is injected for better testing.
 type Clock interface {
 	Now() time.Time
@@ -59,6 +126,7 @@ var clock Clock = &NormalClock{}
 type HostInfo struct {
 	ip        string
 	userAgent string
+	client    string // Optional client name, only set for the audit trail, see requestHost().
 }
 
 func (h *HostInfo) String() string {
@@ -68,19 +136,34 @@ func (h *HostInfo) String() string {
 // The set of remote hosts seen during the operation, and how many times each connected.
 type RemoteHosts struct {
 	sync.Mutex
-	set map[HostInfo]uint64
+	set   map[HostInfo]uint64
+	seen  map[HostInfo]HostSeen // When each host connected first and last, initialized lazily.
+	dirty map[HostInfo]bool     // Hosts changed since they were last stored, initialized lazily.
+	db    *Database             // Persists the hosts, if set.
 }
 
 // Adds the key to 'hosts' set and returns 'true' if it was a new key.
 func (hosts *RemoteHosts) add(key HostInfo) bool {
 	hosts.Lock()
 	defer hosts.Unlock()
-	if _, ok := hosts.set[key]; ok {
-		hosts.set[key]++
-		return false
+	if hosts.set == nil {
+		hosts.set = make(map[HostInfo]uint64)
+	}
+	if hosts.seen == nil {
+		hosts.seen = make(map[HostInfo]HostSeen)
+	}
+
+	now := clock.Now()
+	_, ok := hosts.set[key]
+	hosts.set[key]++
+	seen := hosts.seen[key]
+	if !ok || seen.First.IsZero() {
+		seen.First = now
 	}
-	hosts.set[key] = 1
-	return true
+	seen.Last = now
+	hosts.seen[key] = seen
+	hosts.markDirty(key)
+	return !ok
 }
 
 // Formats hosts summary as a table and returns it in a string.
@@ -109,8 +192,11 @@ func (hosts *RemoteHosts) asTable() (info string) {
 	return
 }
 
-// Pretty-prints the remote hosts summary to the log.
+// Pretty-prints the remote hosts summary to the log. With the database, the
+// hosts are stored first, and the summary includes the hosts seen before the
+// restarts (loaded at startup).
 func (hosts *RemoteHosts) log() {
+	hosts.flush()
 	slog.Info(fmt.Sprintf("remote hosts seen so far: \n%s", hosts.asTable()))
 }
 
@@ -118,7 +204,8 @@ var remoteHosts = RemoteHosts{
 	set: make(map[HostInfo]uint64),
 }
 
-// ModeType is an enum representing the possible "modes": work, rest and off.
+// ModeType is an enum representing the possible "modes": work, rest, off and
+// any user-defined modes, see 'modeRegistry'.
 type ModeType int
 
 const (
@@ -129,26 +216,21 @@ const (
 
 // Returns a string representation of a given ModeType.
 func (m ModeType) toString() string {
-	if m < 0 || m > 2 {
-		return "unknown"
+	if info := m.info(); info != nil {
+		return info.Name
 	}
-	return []string{"work", "rest", "off"}[m]
+	return "unknown"
 }
 
 // Returns a *ModeType for a given string, or nil for invalid strings.
 func modeFromString(str string) *ModeType {
-	var result ModeType
-	switch str {
-	case "work":
-		result = Work
-	case "rest":
-		result = Rest
-	case "off":
-		result = Off
-	default:
-		return nil
+	for i, info := range modeRegistry {
+		if info.Name == str {
+			result := ModeType(i)
+			return &result
+		}
 	}
-	return &result
+	return nil
 }
 
 // State struct represents the full state of the punch clock. Note that it is
@@ -156,10 +238,18 @@ func modeFromString(str string) *ModeType {
 // don't reflect the "total" durations on their own.
 type State struct {
 	sync.Mutex
-	work      time.Duration // Duration of time spent working.
-	rest      time.Duration // Duration of time spent resting.
-	mode      ModeType      // Current mode.
-	modeStart time.Time     // Time of the last mode switch.
+	work       time.Duration            // Duration of time spent working.
+	rest       time.Duration            // Duration of time spent resting.
+	mode       ModeType                 // Current mode.
+	modeStart  time.Time                // Time of the last mode switch.
+	tag        string                   // Project/tag of the current session, if any.
+	tags       map[string]time.Duration // Work time per (non-empty) tag.
+	modeTotals map[string]time.Duration // Time per user-defined mode.
+	ratio      float64                  // Target work/rest ratio, 0 when disabled.
+	schedule   *ScheduleState           // The running schedule, if any.
+	rollover   bool                     // Whether the totals are split at the day boundaries.
+	closed     []closedDay              // Days closed at the day boundaries, not stored yet.
+	history    History                  // Recent changes that can be undone.
 }
 
 // Initialize the punch clock. It starts in the 'off' mode.
@@ -170,6 +260,13 @@ var state = State{
 	modeStart: clock.Now(),
 }
 
+// Describes a mode for the HTML template.
+type modeData struct {
+	Name   string `json:"name"`
+	Counts string `json:"counts"`
+	Color  string `json:"color"`
+}
+
 // Populates the HTML page according to the current state and writes it to the
 // provided ResponseWriter.
 func (state *State) writeHtmlResponse(
@@ -184,11 +281,26 @@ func (state *State) writeHtmlResponse(
 		Rest      float64 // Same.
 		Mode      string
 		ModeStart int64 // JS code expects this in milliseconds.
+		Tag       string
+		Ratio     float64
+		DayStart  int        // Minutes after midnight.
+		Modes     []modeData // All the modes, for the JS code.
+		Custom    []modeData // User-defined modes, for the extra buttons.
 	}{
 		Work:      state.work.Seconds(),
 		Rest:      state.rest.Seconds(),
 		Mode:      state.mode.toString(),
 		ModeStart: state.modeStart.UnixMilli(),
+		Tag:       state.tag,
+		Ratio:     state.ratio,
+		DayStart:  int(dayOffset.Minutes()),
+	}
+	for i, info := range modeRegistry {
+		mode := modeData{info.Name, info.Counts.toString(), info.Color}
+		data.Modes = append(data.Modes, mode)
+		if ModeType(i).isCustom() {
+			data.Custom = append(data.Custom, mode)
+		}
 	}
 	return tmpl.Execute(w, data)
 }
@@ -203,53 +315,134 @@ func (state *State) toJson() string {
 	state.Lock()
 	defer state.Unlock()
 
-	return fmt.Sprintf(
-		`{"mode": "%s", "work": %.2f, "rest": %.2f, "modeStart": %d}`,
+	result := fmt.Sprintf(
+		`{"mode": "%s", "work": %.2f, "rest": %.2f, "modeStart": %d`,
 		state.mode.toString(),
 		state.work.Seconds(),
 		state.rest.Seconds(),
 		clock.Now().Sub(state.modeStart).Milliseconds()) // X milliseconds ago.
+
+	// Optional fields are only present when set.
+	if state.tag != "" {
+		result += fmt.Sprintf(`, "tag": %s`, jsonString(state.tag))
+	}
+	if len(state.tags) > 0 {
+		result += fmt.Sprintf(`, "tags": %s`, jsonSeconds(state.tags))
+	}
+	if len(state.modeTotals) > 0 {
+		result += fmt.Sprintf(`, "modes": %s`, jsonSeconds(state.modeTotals))
+	}
+	if state.ratio > 0 {
+		result += fmt.Sprintf(`, "ratio": %.2f, "earned": %.2f`,
+			state.ratio, state.earnedRest(clock.Now()).Seconds())
+	}
+	if state.schedule != nil {
+		result += fmt.Sprintf(`, "schedule": %s`, state.schedule.toJson())
+	}
+	return result + "}"
 }
 
 // Resets 'modeStart' to 'time.Now()', and updates the 'work' and 'rest' times.
 // Assumes the mutex is locked and unlocked by the caller.
 func (state *State) resetModeStart() {
-	var now = clock.Now()
+	state.advanceTo(clock.Now())
+}
+
+// Resets 'modeStart' to 'now', and updates the 'work' and 'rest' times. With
+// '-rollover', the time is split at the day boundaries in between, closing the
+// previous days.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) advanceTo(now time.Time) {
+	if state.rollover {
+		state.splitDays(now)
+	}
+	state.accumulate(now)
+}
+
+// Adds the time since 'modeStart' to the totals, and resets 'modeStart' to 'now'.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) accumulate(now time.Time) {
 	var duration = now.Sub(state.modeStart)
 	if duration < 0 {
 		slog.Error("resetting backwards in time, ignoring.", "now", now, "modeStart", state.modeStart)
 		return
 	}
 
-	switch state.mode {
-	case Work:
+	switch state.mode.counts() {
+	case CountsWork:
 		state.work += duration
-	case Rest:
+		state.addTagWork(duration)
+	case CountsRest:
 		state.rest += duration
-	case Off:
+	case CountsNone:
 		// No-op
-	default:
-		panic(fmt.Sprintf("Unhandled mode: %v.", state.mode))
 	}
+	state.addModeTime(duration)
 
 	state.modeStart = now
 }
 
-// Changes the current mode (if necessary).
-func (state *State) changeMode(modeString string) {
-	newMode := modeFromString(modeString)
+// Changes the current mode and tag (if necessary) as of 'at', which is between
+// the start of the current mode and now. Zero 'at' means now, empty
+// 'modeString' keeps the current mode. The time since 'at' is attributed to the
+// new mode. Returns the resulting Transition, or nil if nothing was changed.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) changeModeAtLocked(modeString string, tag string, at time.Time) (*Transition, error) {
+	var newMode *ModeType
+	if modeString != "" {
+		if newMode = modeFromString(modeString); newMode == nil {
+			slog.Info("unknown mode specified, ignoring.", "mode", modeString)
+			return nil, nil
+		}
+	}
+	tag = normalizeTag(tag)
+
+	now := clock.Now()
+	if at.IsZero() {
+		at = now
+	}
+	if at.Before(state.modeStart) {
+		return nil, fmt.Errorf("Invalid time: '%s', before the current mode started at '%s'.",
+			at.Format(time.RFC3339), state.modeStart.Format(time.RFC3339))
+	}
+	if at.After(now) {
+		return nil, fmt.Errorf("Invalid time: '%s', in the future.", at.Format(time.RFC3339))
+	}
+
 	if newMode == nil {
-		slog.Info("unknown mode specified, ignoring.", "mode", modeString)
-		return
+		newMode = &state.mode
 	}
-	if state.mode == *newMode {
-		return
+	if state.mode == *newMode && state.tag == tag {
+		return nil, nil
 	}
-	state.Lock()
-	defer state.Unlock()
+	if state.mode != *newMode {
+		// Manual mode changes take over from the schedule, if it's running.
+		state.stopSchedule()
+	}
+	state.remember(state.toSnapshot())
+	return state.switchModeAt(*newMode, tag, at), nil
+}
 
-	state.resetModeStart()
-	state.mode = *newMode
+// Switches to the mode and tag, returns the resulting Transition, or nil if
+// nothing was changed.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) switchMode(newMode ModeType, tag string) *Transition {
+	return state.switchModeAt(newMode, tag, clock.Now())
+}
+
+// Switches to the mode and tag as of 'at', returns the resulting Transition, or
+// nil if nothing was changed.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) switchModeAt(newMode ModeType, tag string, at time.Time) *Transition {
+	if state.mode == newMode && state.tag == tag {
+		return nil
+	}
+
+	oldMode := state.mode
+	state.advanceTo(at)
+	state.mode = newMode
+	state.tag = tag
+	return &Transition{Time: state.modeStart, From: oldMode.toString(), To: newMode.toString(), Tag: tag}
 }
 
 // Patches the value at time.Duration address. Minimum resulting duration is 1s.
@@ -270,41 +463,62 @@ func patchDuration(field *time.Duration, str string) {
 }
 
 // Patches work/rest durations, based on strings in time.Duration format.
-func (state *State) patchDurations(workString string, restString string) {
-	state.Lock()
-	defer state.Unlock()
-
+// Returns the resulting Transition (which keeps the mode unchanged).
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) patchDurationsLocked(workString string, restString string) *Transition {
+	state.remember(state.toSnapshot())
 	state.resetModeStart()
 	patchDuration(&state.work, workString)
 	patchDuration(&state.rest, restString)
+	state.patchTagWork(workString)
+	state.patchModeTotals()
+	mode := state.mode.toString()
+	return &Transition{
+		Time: state.modeStart, From: mode, To: mode, Tag: state.tag, Work: workString, Rest: restString}
 }
 
-// Returns the total work/rest durations.
+// Returns the total work/rest durations. With '-rollover', only the time within
+// the cutoff's day is counted.
 func (state *State) getTotalDurations(cutoff time.Time) (work, rest time.Duration) {
 	state.Lock()
 	defer state.Unlock()
+	return state.totals(cutoff)
+}
 
-	work, rest = state.work, state.rest
+// Returns the total work/rest durations.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) totals(cutoff time.Time) (work, rest time.Duration) {
+	from, stale := state.intervalStart(cutoff)
+	if !stale {
+		work, rest = state.work, state.rest
+	}
 
-	var duration = cutoff.Sub(state.modeStart)
+	var duration = cutoff.Sub(from)
 	if duration < 0 {
 		slog.Error("time goes backwards, ignoring.", "cutoff", cutoff, "modeStart", state.modeStart)
 		return
 	}
 
-	switch state.mode {
-	case Work:
+	switch state.mode.counts() {
+	case CountsWork:
 		work += duration
-	case Rest:
+	case CountsRest:
 		rest += duration
-	case Off:
+	case CountsNone:
 		// No-op
-	default:
-		panic(fmt.Sprintf("Unhandled mode: %v.", state.mode))
 	}
 	return
 }
 
+// Returns 'true' if the flag was set on the command line, rather than defaulted.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		passed = passed || f.Name == name
+	})
+	return passed
+}
+
 // Constructs a human-readable string representing the remote host.
 func getRemoteHost(r *http.Request) HostInfo {
 	addr := r.RemoteAddr
@@ -318,6 +532,18 @@ func getRemoteHost(r *http.Request) HostInfo {
 	}
 }
 
+// Returns the remote host along with the client name: the name of the request's
+// API token, or the 'X-Time3-Client' header.
+func requestHost(r *http.Request) HostInfo {
+	host := getRemoteHost(r)
+	if name, ok := r.Context().Value(clientKey{}).(string); ok {
+		host.client = name
+	} else {
+		host.client = truncate(r.Header.Get("X-Time3-Client"), 64)
+	}
+	return host
+}
+
 func truncate(s string, l int) string {
 	if len(s) <= l {
 		return s
@@ -326,10 +552,39 @@ func truncate(s string, l int) string {
 }
 
 // JsonRequest struct represents the body of an HTTP POST request.
+// The field names are matched case-insensitively when unmarshalling.
 type JsonRequest struct {
-	Mode string
-	Work string
-	Rest string
+	Mode     string  `json:"mode,omitempty"`
+	Tag      string  `json:"tag,omitempty"` // Optional project/tag for the mode switch.
+	Work     string  `json:"work,omitempty"`
+	Rest     string  `json:"rest,omitempty"`
+	Ratio    float64 `json:"ratio,omitempty"`    // Target work/rest ratio, see '-ratio'.
+	Schedule string  `json:"schedule,omitempty"` // Starts a schedule ("pomodoro", "52-17"), or "stop"s or "skip"s the running one.
+	Command  string  `json:"command,omitempty"`  // Either "undo" or "redo" the most recent mode change or duration patch.
+	At       string  `json:"at,omitempty"`       // Optional time of the mode change in the past, in RFC3339 format.
+	Ago      string  `json:"ago,omitempty"`      // Optional duration since the mode change in the past, like '15m', instead of 'At'.
+}
+
+// Returns the time of the mode change requested with 'At' or 'Ago', or zero
+// time if neither is set.
+func (r *JsonRequest) changeTime() (time.Time, error) {
+	switch {
+	case r.At != "" && r.Ago != "":
+		return time.Time{}, fmt.Errorf("Only one of 'at' and 'ago' can be set.")
+	case r.At != "":
+		at, err := time.Parse(time.RFC3339, r.At)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid time: '%s'.", r.At)
+		}
+		return at, nil
+	case r.Ago != "":
+		ago, err := time.ParseDuration(r.Ago)
+		if err != nil || ago < 0 {
+			return time.Time{}, fmt.Errorf("Invalid duration: '%s'.", r.Ago)
+		}
+		return clock.Now().Add(-ago), nil
+	}
+	return time.Time{}, nil
 }
 
 // Returns JsonRequest for the HTTP request body, or nil in case of errors.
@@ -349,18 +604,87 @@ func parseRequestBody(r *http.Request) (*JsonRequest, error) {
 }
 
 // Understands various possibilities present in the JsonRequest and updates the
-// state accordingly.
-func handleJsonRequest(jsonRequest *JsonRequest) {
-	if jsonRequest.Work != "" || jsonRequest.Rest != "" {
+// state accordingly. The 'host' is the remote host the request came from.
+// Returns an error for invalid requests, like backdated mode changes to before
+// the current mode started.
+func handleJsonRequest(jsonRequest *JsonRequest, host HostInfo) error {
+	at, err := jsonRequest.changeTime()
+	if err != nil {
+		return err
+	}
+	if !at.IsZero() && (jsonRequest.Work != "" || jsonRequest.Rest != "" || jsonRequest.Schedule != "" ||
+		jsonRequest.Command != "") {
+		return fmt.Errorf("Only mode changes can be backdated with 'at' or 'ago'.")
+	}
+
+	// The State before and after the request is recorded in the same critical
+	// section as the request itself, for the audit log.
+	state.Lock()
+	before := state.toSnapshot()
+	transition, changed, publish, err := state.applyRequest(jsonRequest, at)
+	after := state.toSnapshot()
+	state.Unlock()
+
+	if !publish {
+		return err
+	}
+	publishChange(transition, host.String(), changed)
+	if changed {
+		logAudit(host, jsonRequest, before, after)
+	}
+	return err
+}
+
+// Updates the State according to the request. Returns the resulting Transition
+// (if any), whether the State was changed, and whether the resulting State
+// should be published.
+// Assumes the mutex is locked and unlocked by the caller.
+func (state *State) applyRequest(jsonRequest *JsonRequest, at time.Time) (
+	transition *Transition, changed bool, publish bool, err error) {
+	var ratioChanged, ok bool
+	if jsonRequest.Ratio != 0 {
+		// The ratio can be changed together with any of the requests below.
+		ratioChanged = state.setRatioLocked(jsonRequest.Ratio)
+	}
+
+	if jsonRequest.Command != "" {
+		// This is a request for undoing or redoing the most recent change.
+		transition, ok, err = state.undoRedoLocked(jsonRequest.Command)
+		return transition, ok || ratioChanged, ok || ratioChanged, err
+	} else if jsonRequest.Work != "" || jsonRequest.Rest != "" {
 		// This is a request for patching work/rest durations.
-		state.patchDurations(jsonRequest.Work, jsonRequest.Rest)
-		clients.broadcast(state.toJson())
-	} else if jsonRequest.Mode != "" {
-		// This is a request attempting to update the mode.
+		transition = state.patchDurationsLocked(jsonRequest.Work, jsonRequest.Rest)
+		return transition, true, true, nil
+	} else if jsonRequest.Schedule != "" {
+		// This is a request for controlling the automatic schedule.
+		transition, ok = state.controlScheduleLocked(jsonRequest.Schedule)
+		return transition, ok || ratioChanged, ok || ratioChanged, nil
+	} else if jsonRequest.Mode != "" || jsonRequest.Tag != "" {
+		// This is a request attempting to update the mode and/or the tag.
 		// TODO(zvold): consider updating the daily total on mode changing to 'off'.
-		state.changeMode(jsonRequest.Mode)
-		clients.broadcast(state.toJson())
+		transition, err = state.changeModeAtLocked(jsonRequest.Mode, jsonRequest.Tag, at)
+		// The State is published even if nothing has changed, unless the request was invalid.
+		return transition, transition != nil || ratioChanged, err == nil || ratioChanged, err
+	}
+	return nil, ratioChanged, ratioChanged, nil
+}
+
+// Persists and logs the transition (if any), and broadcasts the resulting
+// State to all clients. The State is also persisted when 'changed' is set.
+func publishChange(transition *Transition, host string, changed bool) {
+	rolledOver := storeClosedDays(db)
+	if transition != nil || changed || rolledOver {
+		saveState()
 	}
+	if transition != nil {
+		transition.Host = host
+		metrics.modeChanged(transition)
+		logTransition(transition)
+	}
+	if transition != nil || changed {
+		webhooks.notify("change", transition, nil)
+	}
+	clients.broadcast(state.toJson())
 }
 
 // Logs the remote peer if it's seen for the first time.
@@ -415,13 +739,19 @@ func mainPageHandler(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, "%s", state.toJson())
 		}()
 
+		if !hasScope(r, ScopeControl) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		jsonRequest, err := parseRequestBody(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		slog.Info("HTTP POST message received.", "request", jsonRequest)
-		handleJsonRequest(jsonRequest)
+		if err := handleJsonRequest(jsonRequest, requestHost(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 	} else {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -432,7 +762,9 @@ func mainPageHandler(w http.ResponseWriter, r *http.Request) {
 func websocketHandler(w http.ResponseWriter, r *http.Request) {
 	logNewPeer(r)
 
-	upgrader := websocket.Upgrader{}
+	// The "time3" subprotocol is accepted so browsers can pass the token as
+	// another subprotocol (see tokenFromRequest()).
+	upgrader := websocket.Upgrader{Subprotocols: []string{"time3"}}
 	c, err := upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
@@ -440,7 +772,7 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := WsClient{conn: c}
+	client := WsClient{conn: c, connectedAt: clock.Now(), remoteAddr: r.RemoteAddr, userAgent: r.UserAgent()}
 	clients.add(&client)
 
 	defer func() {
@@ -448,6 +780,22 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 		c.Close()
 	}()
 
+	// Clients not responding to the pings (or sending anything) in time are disconnected.
+	pongWait := 2 * *wsPingFlag
+	extendDeadline := func(string) error {
+		if pongWait <= 0 {
+			return nil
+		}
+		return c.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	if pongWait > 0 {
+		extendDeadline("")
+		c.SetPongHandler(extendDeadline)
+		done := make(chan struct{})
+		defer close(done)
+		go client.keepalive(*wsPingFlag, done)
+	}
+
 	slog.Debug("websocket connection established, looping...")
 	err = client.send(state.toJson())
 	if err == nil {
@@ -456,10 +804,15 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 
 	for {
 		mtype, message, err := c.ReadMessage()
-		if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			slog.Info("websocket client is unresponsive, closing.", "remote", r.RemoteAddr)
+			break
+		} else if err != nil {
 			slog.Debug("websocket read error, closing.", "error", err)
 			break
 		}
+		extendDeadline("")
 
 		slog.Info("websocket message received.", "type", mtype, "message", message)
 		switch mtype {
@@ -473,7 +826,13 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 				slog.Info("error while unmarshalling, ignoring.", "error", err)
 				break
 			}
-			handleJsonRequest(&jsonRequest)
+			if !hasScope(r, ScopeControl) {
+				slog.Info("read-only client, ignoring.", "request", jsonRequest)
+				break
+			}
+			if err := handleJsonRequest(&jsonRequest, requestHost(r)); err != nil {
+				slog.Info("invalid request, ignoring.", "request", jsonRequest, "err", err)
+			}
 		case websocket.CloseMessage:
 			slog.Debug("websocket close received, closing.")
 			return
@@ -484,13 +843,53 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	// Subcommands like 'time3 status' run the command-line client instead.
+	if isClientCommand(os.Args[1:]) {
+		if err := runClient(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	if *verboseFlag {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	}
 
-	var db *Database
+	if *modesFlag != "" {
+		if err := loadModes(*modesFlag); err != nil {
+			slog.Error("cannot load modes.", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := setTimezone(*tzFlag); err != nil {
+		slog.Error("cannot set the time zone.", "err", err)
+		os.Exit(1)
+	}
+
+	if err := setDayStart(*dayStartFlag); err != nil {
+		slog.Error("cannot set the day start.", "err", err)
+		os.Exit(1)
+	}
+
+	if err := configureSchedules(); err != nil {
+		slog.Error("invalid schedule.", "err", err)
+		os.Exit(1)
+	}
+
+	if err := state.initRatio(*ratioFlag); err != nil {
+		slog.Error("invalid ratio.", "err", err)
+		os.Exit(1)
+	}
+
+	if *dbFlag == "" && (*importFlag != "" || *authFlag || tokenCommand()) {
+		slog.Error("'-import', '-auth' and '-token-*' flags require '-db' to be set.")
+		os.Exit(1)
+	}
+
 	if *dbFlag != "" {
 		var dbErr error
 		db, dbErr = InitDB(*dbFlag)
@@ -499,16 +898,75 @@ func main() {
 			os.Exit(1)
 		}
 
+		if *importFlag != "" {
+			if err := importFile(db, *importFlag, *importModeFlag); err != nil {
+				slog.Error("cannot import days.", "err", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		if tokenCommand() {
+			if err := manageTokens(db, os.Stdout); err != nil {
+				slog.Error("cannot manage tokens.", "err", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
 		totalDays := db.DaysCount()
 		slog.Info("Logged days:", "count", totalDays)
 
-		db.StartLogger(&state)
+		if err := remoteHosts.load(db); err != nil {
+			slog.Error("cannot load the remote hosts.", "err", err)
+			os.Exit(1)
+		}
+
+		stateStore = db
+	} else if *stateFlag != "" {
+		stateStore = &StateFile{path: *stateFlag}
 	}
 
-	http.HandleFunc("/", mainPageHandler)
-	http.HandleFunc("/ws", websocketHandler)
-	http.HandleFunc("/favicon.ico", faviconHandler)
-	http.HandleFunc("/graph", graphPageHandler(db))
+	if stateStore != nil {
+		if err := loadState(stateStore); err != nil {
+			slog.Error("cannot restore the persisted state.", "err", err)
+			os.Exit(1)
+		}
+		// An explicitly set '-ratio' takes precedence over the persisted one,
+		// so that e.g. '-ratio=0' disables it.
+		if flagPassed("ratio") {
+			state.initRatio(*ratioFlag)
+		}
+	}
+
+	if *webhooksFlag != "" {
+		targets, err := loadWebhooks(*webhooksFlag)
+		if err != nil {
+			slog.Error("cannot load webhooks.", "err", err)
+			os.Exit(1)
+		}
+		webhooks = newWebhooks(targets, *webhookTimeoutFlag, *webhookRetriesFlag, db)
+	}
+
+	rollover := startRollover(db, *rolloverFlag)
+
+	// With '-auth', all requests need at least a read-only token. Handlers check
+	// for the 'control' scope themselves, when the state is about to change.
+	// The websocket and SSE handlers aren't instrumented, as they run for the whole connection.
+	http.HandleFunc("/", instrument("main", requireScope(ScopeRead, mainPageHandler)))
+	http.HandleFunc("/ws", requireScope(ScopeRead, websocketHandler))
+	http.HandleFunc("/events", requireScope(ScopeRead, eventsHandler))
+	http.HandleFunc("/favicon.ico", instrument("favicon", faviconHandler))
+	http.HandleFunc("/graph", instrument("graph", requireScope(ScopeRead, graphPageHandler(db))))
+	http.HandleFunc("/api/intervals", instrument("intervals", requireScope(ScopeRead, intervalsHandler(db))))
+	http.HandleFunc("/api/days", instrument("days", requireScope(ScopeRead, daysHandler(db))))
+	http.HandleFunc("/api/export", instrument("export", requireScope(ScopeRead, exportHandler(db))))
+	http.HandleFunc("/api/import", instrument("import", requireScope(ScopeControl, importHandler(db))))
+	http.HandleFunc("/api/webhooks", instrument("webhooks", requireScope(ScopeControl, deliveriesHandler(db))))
+	http.HandleFunc("/api/audit", instrument("audit", requireScope(ScopeControl, auditHandler(db))))
+	http.HandleFunc("/admin/hosts", instrument("admin_hosts", requireScope(ScopeControl, hostsPageHandler)))
+	http.HandleFunc("/api/hosts", instrument("hosts", requireScope(ScopeControl, hostsHandler)))
+	http.HandleFunc("/metrics", requireScope(ScopeRead, metricsHandler))
 
 	// Log cumulative remote hosts stats every hour.
 	hostsLogger := time.NewTicker(1 * time.Hour)
@@ -546,10 +1004,11 @@ func main() {
 		signal.Notify(sigint, os.Interrupt)
 		<-sigint
 
-		// Block until daily logger gorouting is stopped.
-		if db != nil {
-			db.StopLogger()
-		}
+		// Block until the daily rollover goroutine is stopped.
+		rollover.stop()
+		// Block until the webhook deliveries in progress end. The events from the
+		// requests still handled until the servers shut down aren't delivered.
+		webhooks.stop()
 
 		hostsLogger.Stop()
 		slog.Info("Final remote hosts stats on shutdown:")
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Transition is a single entry in the append-only log of State mutations:
+// either a mode change, or a patch of work/rest durations (From == To).
+type Transition struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Host string    `json:"host"`
+	Tag  string    `json:"tag,omitempty"`  // Tag after the transition.
+	Work string    `json:"work,omitempty"` // Work duration patch, if any.
+	Rest string    `json:"rest,omitempty"` // Rest duration patch, if any.
+}
+
+// Interval is a continuous period of time spent in the same mode (and tag).
+type Interval struct {
+	Mode  string    `json:"mode"`
+	Tag   string    `json:"tag,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Marshals the Interval with an additional 'seconds' field, for convenience.
+func (i Interval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Mode    string    `json:"mode"`
+		Tag     string    `json:"tag,omitempty"`
+		Start   time.Time `json:"start"`
+		End     time.Time `json:"end"`
+		Seconds float64   `json:"seconds"`
+	}{i.Mode, i.Tag, i.Start, i.End, i.End.Sub(i.Start).Seconds()})
+}
+
+// Appends the transition to the log.
+func (db *Database) LogTransition(t *Transition) error {
+	_, err := db.db.Exec(
+		`insert into transitions(time, old_mode, new_mode, host, tag, work, rest) values (?, ?, ?, ?, ?, ?, ?)`,
+		t.Time.UnixMilli(), t.From, t.To, t.Host, t.Tag, t.Work, t.Rest)
+	return err
+}
+
+// Returns all transitions logged within [from, to], in chronological order.
+func (db *Database) ReadTransitions(from, to time.Time) ([]Transition, error) {
+	rows, err := db.db.Query(`
+		select time, old_mode, new_mode, host, tag, work, rest from transitions
+		where time >= ? and time <= ? order by time, id`,
+		from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Transition, 0)
+	for rows.Next() {
+		var t Transition
+		var millis int64
+		if err := rows.Scan(&millis, &t.From, &t.To, &t.Host, &t.Tag, &t.Work, &t.Rest); err != nil {
+			return nil, err
+		}
+		t.Time = time.UnixMilli(millis)
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// Returns the transitions logged after the one with 'id' at or before 'to', in
+// chronological order. The transitions replaced by the ones logged after them
+// at an earlier time are skipped, see ReadIntervals().
+func (db *Database) readTransitionsAfter(id int64, to time.Time) ([]Transition, error) {
+	rows, err := db.db.Query(`
+		select time, old_mode, new_mode, host, tag, work, rest from transitions
+		where id > ? and time <= ? order by id`,
+		id, to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Transition, 0)
+	for rows.Next() {
+		var t Transition
+		var millis int64
+		if err := rows.Scan(&millis, &t.From, &t.To, &t.Host, &t.Tag, &t.Work, &t.Rest); err != nil {
+			return nil, err
+		}
+		t.Time = time.UnixMilli(millis)
+		i := len(result)
+		for i > 0 && result[i-1].Time.After(t.Time) {
+			i--
+		}
+		result = append(result[:i], t)
+	}
+	return result, rows.Err()
+}
+
+// Returns the intervals spent in each mode within [from, to], in chronological
+// order. Intervals are clipped to the requested range, and the currently
+// ongoing interval ends at the current time.
+//
+// Transitions are normally logged in chronological order. A transition logged
+// at an earlier time than the ones before it (like an undo, which restores the
+// mode as of the restored State's start, see revertTo()) replaces the ones
+// after its time: the mode at any time is the one of the most recently logged
+// transition at or before it.
+func (db *Database) ReadIntervals(from, to time.Time) ([]Interval, error) {
+	if now := clock.Now(); to.After(now) {
+		to = now
+	}
+
+	// The mode and tag at 'from' are determined by the last transition logged before it.
+	var id int64
+	var mode, tag string
+	err := db.db.QueryRow(`
+		select id, new_mode, tag from transitions
+		where time < ? order by id desc limit 1`,
+		from.UnixMilli()).Scan(&id, &mode, &tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		mode = "" // Nothing is known about the time before the first transition.
+	} else if err != nil {
+		return nil, err
+	}
+	start := from
+
+	// All the transitions logged later are at or after 'from'.
+	transitions, err := db.readTransitionsAfter(id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Interval, 0)
+	appendInterval := func(end time.Time) {
+		if mode != "" && end.After(start) {
+			result = append(result, Interval{Mode: mode, Tag: tag, Start: start, End: end})
+		}
+	}
+	for _, t := range transitions {
+		if t.To == mode && t.Tag == tag {
+			continue // Duration patches don't change the mode.
+		}
+		appendInterval(t.Time)
+		mode, tag, start = t.To, t.Tag, t.Time
+	}
+	appendInterval(to)
+	return result, nil
+}
+
+// Appends the transition to the database log, if the database is enabled.
+func logTransition(t *Transition) {
+	if db == nil {
+		return
+	}
+	if err := db.LogTransition(t); err != nil {
+		slog.Error("failed to log the transition.", "transition", t, "err", err)
+		metrics.dbError("log_transition")
+	}
+}
+
+// Parses a time given either in RFC3339 format, or as a 'yyyy-mm-dd' date. For
+// dates, 'end' selects the end of the day rather than its start.
+func parseTime(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if !datePattern2.MatchString(s) {
+		return time.Time{}, fmt.Errorf("Invalid time: '%s'.", s)
+	}
+	t, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time: '%s'.", s)
+	}
+	if end {
+		t = nextDayStart(t).Add(-time.Millisecond)
+	}
+	return t, nil
+}
+
+// Responds with JSON list of intervals spent in each mode. The request has to specify:
+//   - 'from', the start of the time range
+//   - 'to', optional end of the time range, defaults to now
+func intervalsHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+
+		params := r.URL.Query()
+		from, err := parseTime(params.Get("from"), false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to := clock.Now()
+		if params.Get("to") != "" {
+			if to, err = parseTime(params.Get("to"), true); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		intervals, err := db.ReadIntervals(from, to)
+		if err != nil {
+			slog.Error("failed to read intervals.", "err", err)
+			metrics.dbError("read_intervals")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, intervals)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_changeMode_transition(t *testing.T) {
+	state := State{mode: Work, modeStart: clock.Now()}
+
+	mockClock.now = mockClock.now.Add(50 * time.Second)
+	got, _ := state.changeModeAtLocked("rest", "", time.Time{})
+	want := Transition{Time: clock.Now(), From: "work", To: "rest"}
+	if got == nil || *got != want {
+		t.Errorf("state.changeModeAtLocked(), want: %+v, got: %+v", want, got)
+	}
+
+	// Same mode again: no transition.
+	if got, _ := state.changeModeAtLocked("rest", "", time.Time{}); got != nil {
+		t.Errorf("state.changeModeAtLocked(), want: nil, got: %+v", got)
+	}
+}
+
+func Test_patchDurations_transition(t *testing.T) {
+	state := State{mode: Work, modeStart: clock.Now()}
+
+	got := state.patchDurationsLocked("10s", "")
+	want := Transition{Time: clock.Now(), From: "work", To: "work", Work: "10s"}
+	if got == nil || *got != want {
+		t.Errorf("state.patchDurationsLocked(), want: %+v, got: %+v", want, got)
+	}
+}
+
+func Test_ReadIntervals(t *testing.T) {
+	db := createDB(t)
+
+	t0 := clock.Now()
+	at := func(minutes int) time.Time {
+		return t0.Add(time.Duration(minutes) * time.Minute).Round(0)
+	}
+	for _, tr := range []Transition{
+		{Time: at(0), From: "off", To: "work", Host: "h1"},
+		{Time: at(10), From: "work", To: "work", Host: "h1", Work: "5m"}, // patch
+		{Time: at(30), From: "work", To: "rest", Host: "h2"},
+		{Time: at(40), From: "rest", To: "off", Host: "h1"},
+	} {
+		if err := db.LogTransition(&tr); err != nil {
+			t.Fatalf("db.LogTransition(), unexpected error: %v", err)
+		}
+	}
+	mockClock.now = at(60)
+
+	// Range that cuts into the first 'work' interval.
+	got, err := db.ReadIntervals(at(20), at(100))
+	if err != nil {
+		t.Fatalf("db.ReadIntervals(), unexpected error: %v", err)
+	}
+	want := []Interval{
+		{Mode: "work", Start: at(20), End: at(30)},
+		{Mode: "rest", Start: at(30), End: at(40)},
+		{Mode: "off", Start: at(40), End: at(60)}, // Ongoing, ends now.
+	}
+	if !slices.EqualFunc(got, want, sameInterval) {
+		t.Errorf("db.ReadIntervals(), want: %v, got: %v", want, got)
+	}
+
+	// Range before any transitions is empty.
+	got, _ = db.ReadIntervals(at(-20), at(-10))
+	if len(got) != 0 {
+		t.Errorf("db.ReadIntervals(), want: [], got: %v", got)
+	}
+
+	transitions, _ := db.ReadTransitions(at(0), at(60))
+	if len(transitions) != 4 || transitions[1].Work != "5m" || transitions[2].Host != "h2" {
+		t.Errorf("db.ReadTransitions(), got: %+v", transitions)
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	got, err := parseTime("2025-05-31", false)
+	want := time.Date(2025, 5, 31, 0, 0, 0, 0, time.Local)
+	if err != nil || !got.Equal(want) {
+		t.Errorf("parseTime(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	got, err = parseTime("2025-05-31", true)
+	want = time.Date(2025, 5, 31, 23, 59, 59, 999_000_000, time.Local)
+	if err != nil || !got.Equal(want) {
+		t.Errorf("parseTime(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	got, err = parseTime("2025-05-31T13:14:15Z", false)
+	want = time.Date(2025, 5, 31, 13, 14, 15, 0, time.UTC)
+	if err != nil || !got.Equal(want) {
+		t.Errorf("parseTime(), want: %v, got: %v, %v", want, got, err)
+	}
+
+	if _, err := parseTime("yesterday", false); err == nil {
+		t.Errorf("parseTime(), want: error, got: nil")
+	}
+}
+
+func sameInterval(a, b Interval) bool {
+	return a.Mode == b.Mode && a.Start.Equal(b.Start) && a.End.Equal(b.End)
+}
+
+func Test_ReadIntervals_undo(t *testing.T) {
+	db := createDB(t)
+	saved := mockClock.now
+	defer func() { mockClock.now = saved }()
+
+	t0 := clock.Now()
+	at := func(minutes int) time.Time {
+		return t0.Add(time.Duration(minutes) * time.Minute).Round(0)
+	}
+	for _, tr := range []Transition{
+		{Time: at(0), From: "off", To: "work", Host: "h1"},
+		{Time: at(30), From: "work", To: "rest", Host: "h1"},
+		// Undo of the change to 'rest', logged later at the restored mode start.
+		{Time: at(0), From: "rest", To: "work", Host: "h1", Work: "10m0s", Rest: "-10m0s"},
+		{Time: at(50), From: "work", To: "off", Host: "h1"},
+	} {
+		if err := db.LogTransition(&tr); err != nil {
+			t.Fatalf("db.LogTransition(), unexpected error: %v", err)
+		}
+	}
+	mockClock.now = at(60)
+
+	for _, from := range []int{-10, 20, 40} {
+		got, err := db.ReadIntervals(at(from), at(60))
+		want := []Interval{
+			{Mode: "work", Start: at(max(from, 0)), End: at(50)},
+			{Mode: "off", Start: at(50), End: at(60)},
+		}
+		if err != nil || !slices.EqualFunc(got, want, sameInterval) {
+			t.Errorf("db.ReadIntervals(%d), want: %v, got: %v, %v", from, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Webhook is a target URL receiving the state changes. The payload is signed
+// with the secret, if any.
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Reads the webhook targets from the JSON file, like '[{"url": "...", "secret": "..."}]'.
+func loadWebhooks(path string) ([]Webhook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result []Webhook
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling %s: %v", path, err)
+	}
+	for _, w := range result {
+		if w.URL == "" {
+			return nil, fmt.Errorf("Invalid webhook URL: '%s'.", w.URL)
+		}
+	}
+	return result, nil
+}
+
+// Webhooks delivers the state changes to all the targets in the background.
+type Webhooks struct {
+	targets []Webhook
+	client  *http.Client  // With the '-webhook-timeout' for each attempt.
+	retries int           // Number of retries after the first failed attempt.
+	backoff time.Duration // Delay before the first retry, doubled for each next one.
+	db      *Database     // Delivery log, if the database is enabled.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup // Pending deliveries.
+
+	sync.Mutex      // Guards 'stopped', so no deliveries start while stop() waits.
+	stopped    bool // Set by stop(), the events after it aren't delivered.
+}
+
+// The configured webhooks, nil when there are none.
+var webhooks *Webhooks
+
+func newWebhooks(targets []Webhook, timeout time.Duration, retries int, db *Database) *Webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Webhooks{
+		targets: targets,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		backoff: time.Second,
+		db:      db,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// WebhookPayload is the JSON body of each delivery.
+type WebhookPayload struct {
+	Event      string          `json:"event"` // Either "change" or "rollover".
+	Time       time.Time       `json:"time"`
+	Transition *Transition     `json:"transition,omitempty"`
+	Day        *DayTotal       `json:"day,omitempty"` // Totals of the closed day, for "rollover".
+	State      json.RawMessage `json:"state"`
+}
+
+// Sends the event with the current State to all the targets in the background.
+// Does nothing when no webhooks are configured, or after they're stopped.
+func (h *Webhooks) notify(event string, transition *Transition, day *DayTotal) {
+	if h == nil {
+		return
+	}
+	body, err := json.Marshal(WebhookPayload{
+		Event:      event,
+		Time:       clock.Now(),
+		Transition: transition,
+		Day:        day,
+		State:      json.RawMessage(state.toJson()),
+	})
+	if err != nil {
+		slog.Error("failed to marshal the webhook payload.", "err", err)
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	if h.stopped {
+		slog.Info("webhooks are stopped, not delivering the event.", "event", event)
+		return
+	}
+	for _, target := range h.targets {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			h.deliver(target, event, body)
+		}()
+	}
+}
+
+// Posts the body to the target, retrying with exponential backoff until it
+// succeeds, the retries are exhausted or the webhooks are stopped.
+func (h *Webhooks) deliver(target Webhook, event string, body []byte) {
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		status, err := h.post(target, event, body)
+		h.logDelivery(target.URL, event, attempt, status, err)
+		if err == nil {
+			return
+		}
+		slog.Info("webhook delivery failed.", "url", target.URL, "event", event, "attempt", attempt, "err", err)
+		if attempt > h.retries {
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// Makes a single delivery attempt, returns the response status (0 if there
+// was no response), and an error unless the status is 2xx.
+func (h *Webhooks) post(target Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(h.ctx, "POST", target.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Time3-Event", event)
+	if target.Secret != "" {
+		req.Header.Set("X-Time3-Signature", "sha256="+sign(target.Secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Unexpected status: %s.", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Returns the hex-encoded HMAC-SHA256 of the body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Webhooks) logDelivery(url, event string, attempt, status int, err error) {
+	if h.db == nil {
+		return
+	}
+	d := Delivery{Time: clock.Now(), URL: url, Event: event, Attempt: attempt, Status: status}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if err := h.db.LogDelivery(&d); err != nil {
+		slog.Error("failed to log the webhook delivery.", "err", err)
+		metrics.dbError("log_delivery")
+	}
+}
+
+// Cancels the pending retries, and blocks until the deliveries in progress end.
+// The events notified after this call aren't delivered.
+func (h *Webhooks) stop() {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	h.stopped = true
+	h.Unlock()
+	h.cancel()
+	h.wg.Wait()
+	slog.Info("webhooks have stopped.")
+}
+
+// Delivery is a single attempt to deliver an event to a webhook.
+type Delivery struct {
+	Time    time.Time `json:"time"`
+	URL     string    `json:"url"`
+	Event   string    `json:"event"`
+	Attempt int       `json:"attempt"`
+	Status  int       `json:"status"` // HTTP status, 0 if there was no response.
+	Error   string    `json:"error,omitempty"`
+}
+
+// Appends the delivery attempt to the delivery log.
+func (db *Database) LogDelivery(d *Delivery) error {
+	_, err := db.db.Exec(
+		`insert into deliveries(time, url, event, attempt, status, error) values (?, ?, ?, ?, ?, ?)`,
+		d.Time.UnixMilli(), d.URL, d.Event, d.Attempt, d.Status, d.Error)
+	return err
+}
+
+// Returns up to 'limit' most recent delivery attempts, most recent first.
+func (db *Database) ReadDeliveries(limit int) ([]Delivery, error) {
+	rows, err := db.db.Query(
+		`select time, url, event, attempt, status, error from deliveries order by id desc limit ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Delivery, 0)
+	for rows.Next() {
+		var d Delivery
+		var millis int64
+		if err := rows.Scan(&millis, &d.URL, &d.Event, &d.Attempt, &d.Status, &d.Error); err != nil {
+			return nil, err
+		}
+		d.Time = time.UnixMilli(millis)
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// Returns the most recent webhook delivery attempts as JSON, the request can
+// specify the number of attempts 'n', defaults to 100.
+func deliveriesHandler(db *Database) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logNewPeer(r)
+
+		if db == nil {
+			http.Error(w, "Database is not enabled.", http.StatusNotFound)
+			return
+		}
+		n := parseInt(r.URL.Query().Get("n"), 100)
+		if n < 1 || n > 1000 {
+			http.Error(w, fmt.Sprintf("Invalid n: '%d'.", n), http.StatusBadRequest)
+			return
+		}
+
+		deliveries, err := db.ReadDeliveries(n)
+		if err != nil {
+			slog.Error("failed to read deliveries.", "err", err)
+			metrics.dbError("read_deliveries")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJson(w, deliveries)
+	}
+}
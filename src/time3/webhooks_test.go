@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stand-in for a webhook target, failing the first 'failures' requests.
+type hookServer struct {
+	sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (s *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.Lock()
+	defer s.Unlock()
+	s.bodies = append(s.bodies, body)
+	s.headers = append(s.headers, r.Header)
+	if len(s.bodies) <= s.failures {
+		http.Error(w, "argh", http.StatusServiceUnavailable)
+	}
+}
+
+func newTestWebhooks(t *testing.T, url string, db *Database) *Webhooks {
+	h := newWebhooks([]Webhook{{URL: url, Secret: "s3cr3t"}}, time.Second, 2, db)
+	h.backoff = time.Millisecond
+	t.Cleanup(h.stop)
+	return h
+}
+
+func Test_Webhooks_notify(t *testing.T) {
+	target := &hookServer{failures: 1}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	db := createDB(t)
+	h := newTestWebhooks(t, server.URL, db)
+	h.notify("change", &Transition{From: "off", To: "work", Host: "test"}, nil)
+	h.wg.Wait()
+
+	// The first attempt fails, the retry succeeds.
+	if len(target.bodies) != 2 {
+		t.Fatalf("notify(), want: 2 attempts, got: %d", len(target.bodies))
+	}
+	body := target.bodies[1]
+	if got, want := target.headers[1].Get("X-Time3-Signature"), "sha256="+sign("s3cr3t", body); got != want {
+		t.Errorf("notify(), want signature: %s, got: %s", want, got)
+	}
+	if got := target.headers[1].Get("X-Time3-Event"); got != "change" {
+		t.Errorf("notify(), want event: change, got: %s", got)
+	}
+
+	var payload struct {
+		Event      string         `json:"event"`
+		Transition Transition     `json:"transition"`
+		State      map[string]any `json:"state"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("json.Unmarshal(), unexpected error: %v", err)
+	}
+	if payload.Event != "change" || payload.Transition.To != "work" || payload.State["mode"] == nil {
+		t.Errorf("notify(), want: change to work with the state, got: %s", body)
+	}
+
+	deliveries, _ := db.ReadDeliveries(10)
+	if len(deliveries) != 2 || deliveries[0].Status != 200 || deliveries[1].Status != 503 || deliveries[1].Error == "" {
+		t.Errorf("db.ReadDeliveries(), want: 200 after 503, got: %v", deliveries)
+	}
+}
+
+func Test_Webhooks_retries(t *testing.T) {
+	target := &hookServer{failures: 100}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	db := createDB(t)
+	h := newTestWebhooks(t, server.URL, db)
+	h.notify("rollover", nil, &DayTotal{Date: "2025-06-01", Work: time.Hour})
+	h.wg.Wait()
+
+	// The first attempt and 2 retries.
+	if deliveries, _ := db.ReadDeliveries(10); len(deliveries) != 3 || deliveries[0].Attempt != 3 {
+		t.Errorf("db.ReadDeliveries(), want: 3 attempts, got: %v", deliveries)
+	}
+}
+
+func Test_Webhooks_timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	db := createDB(t)
+	h := newTestWebhooks(t, server.URL, db)
+	h.client.Timeout = 10 * time.Millisecond
+	h.retries = 0
+	h.notify("change", nil, nil)
+	h.wg.Wait()
+
+	if deliveries, _ := db.ReadDeliveries(10); len(deliveries) != 1 || deliveries[0].Status != 0 || deliveries[0].Error == "" {
+		t.Errorf("db.ReadDeliveries(), want: 1 timed out attempt, got: %v", deliveries)
+	}
+}
+
+func Test_Webhooks_stopped(t *testing.T) {
+	target := &hookServer{}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	db := createDB(t)
+	h := newTestWebhooks(t, server.URL, db)
+	h.stop()
+	// E.g. a request handled while the server shuts down.
+	h.notify("change", nil, nil)
+	h.wg.Wait()
+
+	if deliveries, _ := db.ReadDeliveries(10); len(deliveries) != 0 || len(target.bodies) != 0 {
+		t.Errorf("notify(), want: no deliveries after stop(), got: %v", deliveries)
+	}
+}
+
+func Test_Webhooks_nil(t *testing.T) {
+	// No webhooks configured.
+	var h *Webhooks
+	h.notify("change", nil, nil)
+	h.stop()
+}
+
+func Test_loadWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	os.WriteFile(path, []byte(`[{"url": "http://localhost/hook", "secret": "x"}, {"url": "http://localhost/2"}]`), 0644)
+	got, err := loadWebhooks(path)
+	if err != nil || len(got) != 2 || got[0].Secret != "x" {
+		t.Errorf("loadWebhooks(), want: 2 webhooks, got: %v, %v", got, err)
+	}
+
+	os.WriteFile(path, []byte(`[{"secret": "x"}]`), 0644)
+	if _, err := loadWebhooks(path); err == nil {
+		t.Errorf("loadWebhooks(), want: error for missing URL, got: nil")
+	}
+}
+
+func Test_deliveriesHandler(t *testing.T) {
+	db := createDB(t)
+	db.LogDelivery(&Delivery{Time: clock.Now(), URL: "http://localhost/hook", Event: "change", Attempt: 1, Status: 200})
+
+	w := httptest.NewRecorder()
+	deliveriesHandler(db)(w, httptest.NewRequest("GET", "/api/webhooks?n=5", nil))
+	var got []Delivery
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].Status != 200 {
+		t.Errorf("deliveriesHandler(), want: 1 delivery, got: %v, %v", got, err)
+	}
+
+	w = httptest.NewRecorder()
+	deliveriesHandler(db)(w, httptest.NewRequest("GET", "/api/webhooks?n=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("deliveriesHandler(), want: 400, got: %d", w.Code)
+	}
+}